@@ -0,0 +1,76 @@
+package wordfreq
+
+import (
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Attribute names of the aggregate word count table. The table's hash key is
+// the scope, and its range key is the word.
+const (
+	AggregateScopeAttr = "Scope"
+	AggregateWordAttr  = "Word"
+	AggregateCountAttr = "Count"
+)
+
+// AggregateScopes returns the scopes the words of an object are aggregated
+// into. Words are aggregated for the object's bucket, and for the directory
+// prefix of the object's key within the bucket if it has one.
+func AggregateScopes(bucket, key string) []string {
+	scopes := []string{bucket}
+	if dir := path.Dir(key); dir != "." && dir != "/" {
+		scopes = append(scopes, path.Join(bucket, dir))
+	}
+	return scopes
+}
+
+// QueryTopAggregateWords queries the aggregate table for all words counted in
+// the scope, and returns the top most common words, and the total count of all
+// words in the scope. A top of zero or less returns all words.
+func QueryTopAggregateWords(svc dynamodbiface.DynamoDBAPI, tableName, scope string, top int) (Words, int, error) {
+	words := Words{}
+	total := 0
+	var parseErr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("#scope = :scope"),
+		ExpressionAttributeNames: map[string]*string{
+			"#scope": aws.String(AggregateScopeAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":scope": {S: aws.String(scope)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			word, count := item[AggregateWordAttr], item[AggregateCountAttr]
+			if word == nil || count == nil {
+				continue
+			}
+			n, err := strconv.Atoi(aws.StringValue(count.N))
+			if err != nil {
+				parseErr = err
+				return false
+			}
+			words = append(words, Word{Word: aws.StringValue(word.S), Count: n})
+			total += n
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if parseErr != nil {
+		return nil, 0, parseErr
+	}
+
+	sort.Sort(words)
+	if top > 0 && top < len(words) {
+		words = words[:top]
+	}
+	return words, total, nil
+}
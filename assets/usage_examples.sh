@@ -4,7 +4,7 @@
 AWS_REGION="us-west-2" \
 AWS_PROFILE="go-wordfreq" \
 WORKER_RESULT_QUEUE_URL="https://sqs.us-west-2.amazonaws.com/762127142917/ResultsQueue" \
-go run ./cmd/uploads3/main.go go-wordfreq ./assets/apache2.0lic.txt
+go run ./cmd/uploads3 go-wordfreq ./assets/apache2.0lic.txt
 
 # Build and run worker in the shell
 go build -o bin/application ./cmd/worker
@@ -0,0 +1,339 @@
+package wordfreq
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings text can be transcoded to UTF-8 from.
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetLatin1      = "iso-8859-1"
+	CharsetWindows1252 = "windows-1252"
+)
+
+// charsetSniffLen is the length in bytes of the prefix of the content its
+// character encoding is detected from.
+const charsetSniffLen = 4096
+
+// charsetAliases are the other names of the supported character encodings.
+var charsetAliases = map[string]string{
+	"utf-8":        CharsetUTF8,
+	"utf8":         CharsetUTF8,
+	"us-ascii":     CharsetUTF8,
+	"ascii":        CharsetUTF8,
+	"utf-16le":     CharsetUTF16LE,
+	"utf-16be":     CharsetUTF16BE,
+	"iso-8859-1":   CharsetLatin1,
+	"iso8859-1":    CharsetLatin1,
+	"iso_8859-1":   CharsetLatin1,
+	"latin1":       CharsetLatin1,
+	"latin-1":      CharsetLatin1,
+	"windows-1252": CharsetWindows1252,
+	"cp1252":       CharsetWindows1252,
+}
+
+// NormalizeCharset returns the supported character encoding for the name,
+// which is matched case insensitively against the encoding's aliases. An
+// empty string, and false is returned if the encoding is not supported.
+//
+// "utf-16" without a byte order is normalized to big endian. NewTextReader
+// decodes content with this encoding in the order of its byte order mark.
+func NormalizeCharset(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if isUnorderedUTF16(name) {
+		return CharsetUTF16BE, true
+	}
+	charset, ok := charsetAliases[name]
+	return charset, ok
+}
+
+// isUnorderedUTF16 returns if the name is UTF-16 without a byte order.
+func isUnorderedUTF16(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name == "utf-16" || name == "utf16"
+}
+
+// CharsetFromContentType returns the charset parameter of the content type,
+// or an empty string if it does not have one, or its charset is not supported.
+// Content types are often set by default, not by the content's author, so
+// content with an unsupported charset has its encoding detected instead.
+func CharsetFromContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	charset := params["charset"]
+	if _, ok := NormalizeCharset(charset); !ok {
+		return ""
+	}
+	return charset
+}
+
+// NewTextReader returns a reader of the content transcoded to UTF-8, and the
+// character encoding the content was decoded from. The content is checked to
+// be text, the same as CheckTextContent.
+//
+// The content's byte order mark decides its encoding, even if a different
+// charset is set, since a byte order mark is more reliable than a declared
+// charset. Otherwise if the charset is set the content is decoded with it, or
+// if not the encoding is detected from the content's prefix. Content which is
+// valid UTF-8 is UTF-8, content with zero bytes at alternating offsets is
+// UTF-16, and any other content is Windows-1252 if it uses Windows-1252's
+// additional characters, otherwise ISO-8859-1. Byte order marks are removed.
+func NewTextReader(reader io.Reader, charset string) (*bufio.Reader, string, error) {
+	src := bufio.NewReaderSize(reader, charsetSniffLen)
+	head, err := src.Peek(charsetSniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", NewJobError(ErrTransient, err)
+	}
+
+	bomCharset, bomLen := charsetFromBOM(head)
+	if bomCharset != "" {
+		charset = bomCharset
+	} else if charset != "" {
+		normalized, ok := NormalizeCharset(charset)
+		if !ok {
+			return nil, "", NewJobError(ErrUnsupportedFormat,
+				fmt.Errorf("unsupported charset %s", charset))
+		}
+		charset = normalized
+	} else {
+		charset = detectCharset(head)
+	}
+
+	src.Discard(bomLen)
+
+	var text *bufio.Reader
+	switch charset {
+	case CharsetUTF16LE, CharsetUTF16BE:
+		// UTF-16 content is checked after decoding, since the zero bytes of
+		// its characters would look like binary content.
+		order := utf16LittleEndian
+		if charset == CharsetUTF16BE {
+			order = utf16BigEndian
+		}
+		text = bufio.NewReader(&decodeReader{src: src, decode: order.decodeRune})
+		if err := CheckTextContent(text); err != nil {
+			return nil, "", err
+		}
+		return text, charset, nil
+
+	case CharsetLatin1, CharsetWindows1252:
+		if err := CheckTextContent(src); err != nil {
+			return nil, "", err
+		}
+		decode := decodeLatin1
+		if charset == CharsetWindows1252 {
+			decode = decodeWindows1252
+		}
+		text = bufio.NewReader(&decodeReader{src: src, decode: decode})
+
+	default:
+		if err := CheckTextContent(src); err != nil {
+			return nil, "", err
+		}
+		text = src
+	}
+
+	return text, charset, nil
+}
+
+// charsetFromBOM returns the character encoding of the byte order mark at the
+// start of the content, and the mark's length in bytes. An empty string is
+// returned if the content does not start with a byte order mark.
+func charsetFromBOM(head []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return CharsetUTF8, 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return CharsetUTF16LE, 2
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return CharsetUTF16BE, 2
+	default:
+		return "", 0
+	}
+}
+
+// detectCharset detects the character encoding of the content's prefix, which
+// does not have a byte order mark.
+func detectCharset(head []byte) string {
+	// Text in UTF-16 has a zero byte in most characters of Latin scripts,
+	// always at the same offset of the two byte code unit.
+	var evenZeros, oddZeros int
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	if units := len(head) / 2; units > 0 {
+		if oddZeros*10 >= units*3 && evenZeros*10 < units {
+			return CharsetUTF16LE
+		}
+		if evenZeros*10 >= units*3 && oddZeros*10 < units {
+			return CharsetUTF16BE
+		}
+	}
+
+	// The prefix may end in the middle of a multi-byte character.
+	valid := head
+	for i := 0; i < utf8.UTFMax-1 && len(valid) > 0 && !utf8.Valid(valid); i++ {
+		valid = valid[:len(valid)-1]
+	}
+	if utf8.Valid(valid) {
+		return CharsetUTF8
+	}
+
+	for _, b := range head {
+		if b >= 0x80 && b <= 0x9F {
+			return CharsetWindows1252
+		}
+	}
+	return CharsetLatin1
+}
+
+// A decodeReader is a reader of the UTF-8 encoding of the characters decoded
+// from its source reader.
+type decodeReader struct {
+	src     *bufio.Reader
+	decode  func(*bufio.Reader) (rune, error)
+	pending []byte
+	err     error
+}
+
+// Read reads the UTF-8 encoding of the decoded characters into p.
+func (d *decodeReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(d.pending) > 0 {
+			copied := copy(p[n:], d.pending)
+			d.pending = d.pending[copied:]
+			n += copied
+			continue
+		}
+		if d.err != nil {
+			break
+		}
+
+		r, err := d.decode(d.src)
+		if err != nil {
+			d.err = err
+			break
+		}
+		if utf8.RuneLen(r) <= len(p)-n {
+			n += utf8.EncodeRune(p[n:], r)
+		} else {
+			var buf [utf8.UTFMax]byte
+			d.pending = append(d.pending[:0], buf[:utf8.EncodeRune(buf[:], r)]...)
+		}
+	}
+
+	if n > 0 {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+// decodeLatin1 decodes a ISO-8859-1 character, which has the same value as
+// its Unicode code point.
+func decodeLatin1(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return rune(b), nil
+}
+
+// windows1252 are the Unicode code points of the Windows-1252 characters 0x80
+// through 0x9F. Undefined characters use the code point of the same value.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// decodeWindows1252 decodes a Windows-1252 character, which is the same as
+// ISO-8859-1 except for the characters 0x80 through 0x9F.
+func decodeWindows1252(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= 0x80 && b <= 0x9F {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), nil
+}
+
+// utf16ByteOrder is the byte order of the code units of UTF-16 content.
+type utf16ByteOrder bool
+
+const (
+	utf16LittleEndian utf16ByteOrder = false
+	utf16BigEndian    utf16ByteOrder = true
+)
+
+// readUnit reads a UTF-16 code unit.
+func (o utf16ByteOrder) readUnit(src *bufio.Reader) (rune, error) {
+	b, err := src.Peek(2)
+	if len(b) < 2 {
+		if len(b) == 1 {
+			// A trailing odd byte is not a complete character.
+			src.Discard(1)
+			return utf8.RuneError, nil
+		}
+		return 0, err
+	}
+	src.Discard(2)
+	if o == utf16BigEndian {
+		return rune(b[0])<<8 | rune(b[1]), nil
+	}
+	return rune(b[1])<<8 | rune(b[0]), nil
+}
+
+// decodeRune decodes a UTF-16 character, combining surrogate pairs. A
+// surrogate without its pair is decoded as the replacement character.
+func (o utf16ByteOrder) decodeRune(src *bufio.Reader) (rune, error) {
+	r1, err := o.readUnit(src)
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r1) {
+		return r1, nil
+	}
+
+	next, _ := src.Peek(2)
+	if len(next) < 2 {
+		return utf8.RuneError, nil
+	}
+	var r2 rune
+	if o == utf16BigEndian {
+		r2 = rune(next[0])<<8 | rune(next[1])
+	} else {
+		r2 = rune(next[1])<<8 | rune(next[0])
+	}
+	r := utf16.DecodeRune(r1, r2)
+	if r == utf8.RuneError {
+		// Only the first unit is invalid, the next is decoded on its own.
+		return utf8.RuneError, nil
+	}
+	src.Discard(2)
+	return r, nil
+}
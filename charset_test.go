@@ -0,0 +1,154 @@
+package wordfreq
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes the text as UTF-16 in the byte order, with a byte order
+// mark if bom is true.
+func encodeUTF16(text string, order utf16ByteOrder, bom bool) []byte {
+	units := utf16.Encode([]rune(text))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		if order == utf16BigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestNewTextReader(t *testing.T) {
+	const text = "Café “naïve” résumé 😀 words"
+	utf8BOM := []byte{0xEF, 0xBB, 0xBF}
+
+	cases := []struct {
+		name          string
+		content       []byte
+		charset       string
+		expectCharset string
+		expectText    string
+	}{
+		{name: "detect utf-8", content: []byte(text),
+			expectCharset: CharsetUTF8, expectText: text},
+		{name: "detect utf-8 bom", content: append(append([]byte{}, utf8BOM...), text...),
+			expectCharset: CharsetUTF8, expectText: text},
+		{name: "detect utf-16le", content: encodeUTF16(text, utf16LittleEndian, false),
+			expectCharset: CharsetUTF16LE, expectText: text},
+		{name: "detect utf-16be", content: encodeUTF16(text, utf16BigEndian, false),
+			expectCharset: CharsetUTF16BE, expectText: text},
+		{name: "detect utf-16le bom", content: encodeUTF16(text, utf16LittleEndian, true),
+			expectCharset: CharsetUTF16LE, expectText: text},
+		{name: "detect utf-16be bom", content: encodeUTF16(text, utf16BigEndian, true),
+			expectCharset: CharsetUTF16BE, expectText: text},
+		{name: "detect latin-1", content: []byte("caf\xe9 na\xefve"),
+			expectCharset: CharsetLatin1, expectText: "café naïve"},
+		{name: "detect windows-1252", content: []byte("\x93caf\xe9\x94 \x80"),
+			expectCharset: CharsetWindows1252, expectText: "“café” €"},
+		{name: "declared windows-1252", content: []byte("caf\xe9"), charset: "CP1252",
+			expectCharset: CharsetWindows1252, expectText: "café"},
+		{name: "declared utf-16 with le bom", content: encodeUTF16(text, utf16LittleEndian, true), charset: "utf-16",
+			expectCharset: CharsetUTF16LE, expectText: text},
+		{name: "declared utf-16 without bom", content: encodeUTF16(text, utf16BigEndian, false), charset: "UTF-16",
+			expectCharset: CharsetUTF16BE, expectText: text},
+		{name: "bom overrides declared latin-1", content: append(append([]byte{}, utf8BOM...), text...), charset: "iso-8859-1",
+			expectCharset: CharsetUTF8, expectText: text},
+		{name: "bom overrides declared utf-8", content: encodeUTF16(text, utf16BigEndian, true), charset: "utf-8",
+			expectCharset: CharsetUTF16BE, expectText: text},
+		{name: "bom overrides unsupported", content: encodeUTF16(text, utf16LittleEndian, true), charset: "shift_jis",
+			expectCharset: CharsetUTF16LE, expectText: text},
+		{name: "unpaired surrogate", content: encodeUTF16("ab\xed\xa0\x80", utf16LittleEndian, false)[:4],
+			expectCharset: CharsetUTF16LE, expectText: "ab"},
+		{name: "odd trailing byte", content: append(encodeUTF16("words", utf16BigEndian, true), 'x'),
+			expectCharset: CharsetUTF16BE, expectText: "words�"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, charset, err := NewTextReader(bytes.NewReader(c.content), c.charset)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.expectCharset, charset; e != a {
+				t.Errorf("expect %s charset, got %s", e, a)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("expect no error reading, got %v", err)
+			}
+			if e, a := c.expectText, string(b); e != a {
+				t.Errorf("expect %q text, got %q", e, a)
+			}
+		})
+	}
+}
+
+func TestNewTextReaderErrors(t *testing.T) {
+	cases := []struct {
+		name      string
+		content   []byte
+		charset   string
+		expectErr JobErrorCode
+	}{
+		{name: "unsupported charset", content: []byte("words"), charset: "shift_jis",
+			expectErr: ErrUnsupportedFormat},
+		{name: "binary content", content: []byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A, 0, 0, 0, 0x0D},
+			expectErr: ErrUnsupportedFormat},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := NewTextReader(bytes.NewReader(c.content), c.charset)
+			if err == nil {
+				t.Fatalf("expect error")
+			}
+			if e, a := c.expectErr, GetJobErrorCode(err); e != a {
+				t.Errorf("expect %s error code, got %s", e, a)
+			}
+		})
+	}
+}
+
+func TestCharsetFromContentType(t *testing.T) {
+	cases := map[string]string{
+		"":                                "",
+		"text/plain":                      "",
+		"text/plain; charset=ISO-8859-1":  "ISO-8859-1",
+		`text/html; charset="utf-8"`:      "utf-8",
+		"text/plain; charset=utf-16":      "utf-16",
+		"text/plain; charset=shift_jis":   "",
+		"text/plain; charset=x-unknown-1": "",
+		"not a content type;;":            "",
+	}
+
+	for contentType, expect := range cases {
+		if a := CharsetFromContentType(contentType); expect != a {
+			t.Errorf("%q: expect %q charset, got %q", contentType, expect, a)
+		}
+	}
+}
+
+func TestNewTextReaderLongContent(t *testing.T) {
+	// Content longer than the sniffed prefix, with a character split by the
+	// end of the prefix, is still detected as UTF-8.
+	text := strings.Repeat("a", charsetSniffLen-1) + "é" + strings.Repeat(" word", 100)
+	r, charset, err := NewTextReader(strings.NewReader(text), "")
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := CharsetUTF8, charset; e != a {
+		t.Errorf("expect %s charset, got %s", e, a)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if e, a := text, string(b); e != a {
+		t.Errorf("expect content unchanged")
+	}
+}
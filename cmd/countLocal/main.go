@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// combinedKey is the name the combined result of multiple files is printed
+// with.
+const combinedKey = "(combined)"
+
+// stdinName is the filename which reads the content to count from stdin.
+const stdinName = "-"
+
+// Counts the words of local files, or stdin, using the same counting logic
+// and options as the Word Frequency worker. Nothing is uploaded to S3, so
+// this can be used to preview the results the service will return for a file.
+// When multiple files are provided the result of each file is printed,
+// followed by the combined result of all files counted successfully.
+//
+// Counts exceeding the memory budget are spilled to temporary files in the
+// spill directory, and merged once all words are counted.
+//
+// Usage:
+//  countLocal [-top n] [-min-length n] [-language code] [-charset name]
+//      [-max-length n] [-long-words skip|truncate]
+//      [-memory-budget bytes] [-spill-dir dir]
+//      [-format table|json|csv|markdown|bars]
+//      [<filename>|-]...
+func main() {
+	top := flag.Int("top", wordfreq.DefaultTop, "number of most common words collected")
+	minLength := flag.Int("min-length", wordfreq.DefaultMinWordLength, "words shorter than this are not counted, at least 1")
+	maxLength := flag.Int("max-length", wordfreq.DefaultMaxWordLength, "words longer than this many bytes are handled by the long word policy, at least 4, and not less than the min length")
+	longWords := flag.String("long-words", wordfreq.LongWordSkip, "long word policy, skip, or truncate")
+	language := flag.String("language", "", "language of the files, detected from each file if not set")
+	charset := flag.String("charset", "", "character encoding of the files, detected from each file if not set")
+	memoryBudget := flag.Int64("memory-budget", 0, "approximate bytes of word counts held in memory before spilling to disk, 0 for no limit")
+	spillDir := flag.String("spill-dir", "", "directory word counts are spilled to, the system's temporary directory if not set")
+	format := flag.String("format", wordfreq.FormatTable, "output format, table, json, csv, markdown, or bars")
+	flag.Usage = func() {
+		fmt.Printf("usage: %s [flags] [<filename>|-]...\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	opts := wordfreq.AnalysisOptions{
+		Top: *top, MinWordLength: *minLength, Language: *language, Charset: *charset,
+		MaxWordLength: *maxLength, LongWordPolicy: *longWords,
+	}
+	// Zero word lengths would fall back to the defaults, instead of the
+	// lengths requested.
+	if err := opts.Validate(); err != nil || *minLength < 1 || *maxLength < 1 ||
+		!wordfreq.IsValidFormat(*format) || *memoryBudget < 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	filenames := flag.Args()
+	if len(filenames) == 0 {
+		filenames = []string{stdinName}
+	}
+	// Stdin can only be read once, a second read would count no words.
+	stdinCount := 0
+	for _, filename := range filenames {
+		if filename == stdinName {
+			stdinCount++
+		}
+	}
+	if stdinCount > 1 {
+		fmt.Fprintln(os.Stderr, "stdin, -, can only be counted once")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	counter := wordfreq.WordCounter{MemoryBudget: *memoryBudget, TempDir: *spillDir}
+
+	start := time.Now()
+	results := []*wordfreq.JobResult{}
+	fileCounts := []*wordfreq.WordCounts{}
+	failed := false
+	for _, filename := range filenames {
+		result, counts := countFile(counter, filename, opts)
+		if result.Status == wordfreq.JobCompleteFailure {
+			failed = true
+		} else {
+			fileCounts = append(fileCounts, counts)
+		}
+		results = append(results, result)
+	}
+
+	if len(filenames) > 1 {
+		job := &wordfreq.Job{StartedAt: start, Key: combinedKey, Options: opts.WithDefaults()}
+		combined, err := counter.Merge(job.Options.Top, fileCounts...)
+		if err != nil {
+			results = append(results, newFailedResult(job, err))
+			failed = true
+		} else {
+			results = append(results, newResult(job, combined))
+			combined.Close()
+		}
+	}
+	for _, counts := range fileCounts {
+		counts.Close()
+	}
+
+	if err := wordfreq.WriteResults(os.Stdout, *format, results); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to print results", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// countFile counts the words of the file with the counter, returning the
+// file's result, and the counts of all words in the file. The counts must be
+// closed once no longer needed. If the file could not be counted the result
+// will have the failure status set, and the counts will be nil.
+func countFile(counter wordfreq.WordCounter, filename string, opts wordfreq.AnalysisOptions) (*wordfreq.JobResult, *wordfreq.WordCounts) {
+	job := &wordfreq.Job{
+		StartedAt: time.Now(),
+		Key:       filename,
+		Options:   opts.WithDefaults(),
+	}
+
+	var reader io.Reader = os.Stdin
+	if filename != stdinName {
+		f, err := os.Open(filename)
+		if err != nil {
+			code := wordfreq.ErrTransient
+			if os.IsNotExist(err) {
+				code = wordfreq.ErrObjectMissing
+			} else if os.IsPermission(err) {
+				code = wordfreq.ErrAccessDenied
+			}
+			return newFailedResult(job, wordfreq.NewJobError(code, err)), nil
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	text, charset, err := wordfreq.NewTextReader(reader, job.Options.Charset)
+	if err != nil {
+		return newFailedResult(job, err), nil
+	}
+	counts, err := counter.Count(text, job.Options)
+	if err != nil {
+		return newFailedResult(job, err), nil
+	}
+
+	result := newResult(job, counts)
+	result.Language = counts.Language
+	result.LanguageConfidence = counts.LanguageConfidence
+	result.Charset = charset
+	return result, counts
+}
+
+// newResult creates a successful result for the job from the words counted,
+// the same as the worker would for an object.
+func newResult(job *wordfreq.Job, counts *wordfreq.WordCounts) *wordfreq.JobResult {
+	result := &wordfreq.JobResult{
+		Job:            job,
+		Words:          counts.Top,
+		Status:         wordfreq.JobCompleteSuccess,
+		TotalWords:     counts.Total,
+		VocabularySize: counts.Vocabulary,
+		SkippedWords:   counts.SkippedWords,
+		TruncatedWords: counts.TruncatedWords,
+	}
+	result.FinishedAt = time.Now()
+	result.Duration = result.FinishedAt.Sub(job.StartedAt)
+	return result
+}
+
+// newFailedResult creates a failed result for the job with the error.
+func newFailedResult(job *wordfreq.Job, err error) *wordfreq.JobResult {
+	result := &wordfreq.JobResult{
+		Job:           job,
+		Status:        wordfreq.JobCompleteFailure,
+		StatusMessage: err.Error(),
+		ErrorCode:     wordfreq.GetJobErrorCode(err),
+	}
+	result.FinishedAt = time.Now()
+	result.Duration = result.FinishedAt.Sub(job.StartedAt)
+	return result
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// Reads the results recorded by the Word Frequency worker back from DynamoDB.
+// Results are printed in the same formats as the uploads3 command, selected
+// with the -format flag.
+//
+// The history command lists every attempt to process a file, oldest first,
+// from the job history table.
+//
+// The compare command compares the words of two results, reporting the words
+// gained, lost, and changed in rank, along with the similarity of the results.
+// Either result can instead be a local file prefixed with "file:", which is
+// counted with the same options as the other result, or -top if both are local.
+//
+// Usage:
+//  queryResults [-format table|json|csv|markdown|bars] get <tablename> <bucket> <key>
+//  queryResults [-format table|json|csv|markdown|bars] list <tablename> [<bucket>[/<prefix>]]
+//  queryResults [-format table|json|csv|markdown|bars] history <history tablename> <bucket> <key>
+//  queryResults [-format table|json|csv|markdown|bars] [-top n] top <aggregate tablename> <bucket>[/<prefix>]
+//  queryResults [-format table|json|csv|markdown|bars] [-top n] compare <tablename> <bucket>/<key>|file:<filename> <bucket>/<key>|file:<filename>
+func main() {
+	format := flag.String("format", wordfreq.FormatTable, "output format, table, json, csv, markdown, or bars")
+	top := flag.Int("top", wordfreq.DefaultTop, "number of aggregate, or locally counted, words to print, 0 for all")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 || !wordfreq.IsValidFormat(*format) {
+		usage()
+		os.Exit(1)
+	}
+
+	// Create a new instance of the DynamoDB service client. To simplify config
+	// and allow the app to work in multiple regions environment variables will
+	// provide the AWS_REGION, and credentials.
+	svc := dynamodb.New(session.New())
+
+	var err error
+	switch cmd, tableName := args[0], args[1]; {
+	case cmd == "get" && len(args) == 4:
+		err = getResult(svc, tableName, args[2], args[3], *format)
+	case cmd == "list" && len(args) <= 3:
+		prefix := ""
+		if len(args) == 3 {
+			prefix = args[2]
+		}
+		err = listResults(svc, tableName, prefix, *format)
+	case cmd == "history" && len(args) == 4:
+		err = listHistory(svc, tableName, args[2], args[3], *format)
+	case cmd == "top" && len(args) == 3:
+		err = topWords(svc, tableName, strings.TrimSuffix(args[2], "/"), *top, *format)
+	case cmd == "compare" && len(args) == 4:
+		err = compareResults(svc, tableName, args[2], args[3], *top, *format)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("failed to query results,", err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the command's usage to the console.
+func usage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Printf("usage: %s [flags] get <tablename> <bucket> <key>\n", name)
+	fmt.Printf("       %s [flags] list <tablename> [<bucket>[/<prefix>]]\n", name)
+	fmt.Printf("       %s [flags] history <history tablename> <bucket> <key>\n", name)
+	fmt.Printf("       %s [flags] top <aggregate tablename> <bucket>[/<prefix>]\n", name)
+	fmt.Printf("       %s [flags] compare <tablename> <bucket>/<key>|file:<filename> <bucket>/<key>|file:<filename>\n", name)
+	flag.PrintDefaults()
+}
+
+// getResult gets the result item of a single file from the result table, and
+// prints it.
+func getResult(svc dynamodbiface.DynamoDBAPI, tableName, bucket, key, format string) error {
+	result, err := fetchResult(svc, tableName, bucket, key)
+	if err != nil {
+		return err
+	}
+	return wordfreq.WriteResults(os.Stdout, format, []*wordfreq.JobResult{result})
+}
+
+// fetchResult gets the result item of a single file from the result table.
+func fetchResult(svc dynamodbiface.DynamoDBAPI, tableName, bucket, key string) (*wordfreq.JobResult, error) {
+	resp, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Filename": {S: aws.String(path.Join(bucket, key))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Item == nil {
+		return nil, fmt.Errorf("no result for %s/%s", bucket, key)
+	}
+
+	return convertResult(resp.Item)
+}
+
+// listResults scans the result table for all results with a filename that
+// begins with the prefix, and prints them. Since the filename is the table's
+// hash key the table must be scanned instead of queried. The scan is paginated
+// so tables of any size can be listed.
+func listResults(svc dynamodbiface.DynamoDBAPI, tableName, prefix, format string) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+	if prefix != "" {
+		input.FilterExpression = aws.String("begins_with(Filename, :prefix)")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":prefix": {S: aws.String(prefix)},
+		}
+	}
+
+	results := []*wordfreq.JobResult{}
+	var convertErr error
+	err := svc.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			result, err := convertResult(item)
+			if err != nil {
+				convertErr = err
+				return false
+			}
+			results = append(results, result)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if convertErr != nil {
+		return convertErr
+	}
+
+	return wordfreq.WriteResults(os.Stdout, format, results)
+}
+
+// listHistory queries the history table for every attempt to process the
+// file, and prints them oldest first. The query is paginated so files with
+// any number of attempts can be listed.
+func listHistory(svc dynamodbiface.DynamoDBAPI, tableName, bucket, key, format string) error {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("Filename = :filename"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":filename": {S: aws.String(path.Join(bucket, key))},
+		},
+	}
+
+	results := []*wordfreq.JobResult{}
+	var convertErr error
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			result, err := convertResult(item)
+			if err != nil {
+				convertErr = err
+				return false
+			}
+			results = append(results, result)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if convertErr != nil {
+		return convertErr
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no history for %s/%s", bucket, key)
+	}
+
+	return wordfreq.WriteResults(os.Stdout, format, results)
+}
+
+// topWords queries the aggregate table for the top words of the scope, and
+// prints them.
+func topWords(svc dynamodbiface.DynamoDBAPI, tableName, scope string, top int, format string) error {
+	words, total, err := wordfreq.QueryTopAggregateWords(svc, tableName, scope, top)
+	if err != nil {
+		return err
+	}
+
+	return wordfreq.WriteWords(os.Stdout, format, "Top Words for "+scope, words, total)
+}
+
+// compareResults compares the words of the from and to results, and prints the
+// comparison. Local files are counted with the options of the other result, if
+// it was recorded, and the language and charset it was counted with, so both
+// are counted the same way, and have the same number of top words.
+func compareResults(svc dynamodbiface.DynamoDBAPI, tableName, from, to string, top int, format string) error {
+	sources := []string{from, to}
+	results := make([]*wordfreq.JobResult, len(sources))
+
+	opts := wordfreq.AnalysisOptions{Top: top}
+	for i, source := range sources {
+		if strings.HasPrefix(source, localFilePrefix) {
+			continue
+		}
+		parts := strings.SplitN(source, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid result %s, expected <bucket>/<key>", source)
+		}
+		result, err := fetchResult(svc, tableName, parts[0], parts[1])
+		if err != nil {
+			return err
+		}
+		results[i] = result
+
+		// Local files are counted as the result was, with its defaults,
+		// and the language and charset it was counted with, even if they
+		// were detected.
+		opts = result.Job.Options.WithDefaults()
+		if opts.Language == "" {
+			opts.Language = result.Language
+		}
+		if opts.Charset == "" {
+			opts.Charset = result.Charset
+		}
+	}
+	for i, source := range sources {
+		if results[i] != nil {
+			continue
+		}
+		words, err := countLocalFile(strings.TrimPrefix(source, localFilePrefix), opts)
+		if err != nil {
+			return err
+		}
+		results[i] = &wordfreq.JobResult{Words: words, Status: wordfreq.JobCompleteSuccess}
+	}
+
+	for i, result := range results {
+		if result.Status == wordfreq.JobCompleteFailure {
+			return fmt.Errorf("%s failed, %s", sources[i], result.StatusMessage)
+		}
+	}
+
+	c := wordfreq.CompareWords(results[0].Words, results[1].Words)
+	return wordfreq.WriteComparison(os.Stdout, format, from, to, c)
+}
+
+// localFilePrefix is the prefix of results compared which are local files
+// instead of recorded results.
+const localFilePrefix = "file:"
+
+// countLocalFile counts the words of the local file, with the same counting
+// logic as the worker, and returns the top words.
+func countLocalFile(filename string, opts wordfreq.AnalysisOptions) (wordfreq.Words, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, _, err := wordfreq.NewTextReader(f, opts.Charset)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := wordfreq.CountWords(reader, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return wordfreq.TopWords(counts.Words, opts.Top), nil
+}
+
+// convertResult unmarshals the result item into a job result.
+func convertResult(item map[string]*dynamodb.AttributeValue) (*wordfreq.JobResult, error) {
+	record := wordfreq.ResultRecord{}
+	if err := dynamodbattribute.ConvertFromMap(item, &record); err != nil {
+		return nil, fmt.Errorf("unable to deserialize result item, %v", err)
+	}
+	return record.JobResult(), nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// notificationID identifies the bucket's notification configuration created
+// by this command.
+const notificationID = "wordfreq-jobs"
+
+// setupBucket creates the upload bucket if it does not exist, and waits for
+// it to be available.
+func (p *provisioner) setupBucket() error {
+	exists, err := p.bucketExists()
+	if err != nil {
+		return fmt.Errorf("unable to check bucket %s, %v", p.bucket, err)
+	}
+	if exists {
+		fmt.Println("verified bucket", p.bucket)
+		return nil
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(p.bucket)}
+	if p.region != "" && p.region != "us-east-1" {
+		// Buckets outside of us-east-1 must be created with a location.
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(p.region),
+		}
+	}
+	if _, err := p.s3Svc.CreateBucket(input); err != nil {
+		return fmt.Errorf("unable to create bucket %s, %v", p.bucket, err)
+	}
+	if err := p.s3Svc.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(p.bucket)}); err != nil {
+		return fmt.Errorf("bucket %s not available, %v", p.bucket, err)
+	}
+
+	fmt.Println("created bucket", p.bucket)
+	return nil
+}
+
+// notificationEvents are the S3 event types sent to the job queue.
+var notificationEvents = []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}
+
+// setupNotification sets the bucket's notification configuration to send
+// ObjectCreated and ObjectRemoved events to the job queue. An existing
+// configuration for the job queue is verified to send the same events without
+// a filter, and replaced if it does not. Other notification configurations of
+// the bucket are preserved.
+func (p *provisioner) setupNotification(jobQueueArn string) error {
+	config, err := p.s3Svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(p.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to get bucket %s notification configuration, %v", p.bucket, err)
+	}
+
+	queueConfigs := []*s3.QueueConfiguration{}
+	jobQueueConfigs := []*s3.QueueConfiguration{}
+	for _, queueConfig := range config.QueueConfigurations {
+		if aws.StringValue(queueConfig.QueueArn) == jobQueueArn {
+			jobQueueConfigs = append(jobQueueConfigs, queueConfig)
+		} else if aws.StringValue(queueConfig.Id) != notificationID {
+			queueConfigs = append(queueConfigs, queueConfig)
+		}
+	}
+	if len(jobQueueConfigs) == 1 && isJobNotification(jobQueueConfigs[0]) {
+		fmt.Println("verified bucket", p.bucket, "notification configuration")
+		return nil
+	}
+
+	// Configurations for the job queue with other events or filters are
+	// replaced, S3 rejects configurations whose events overlap.
+	config.QueueConfigurations = append(queueConfigs, &s3.QueueConfiguration{
+		Id:       aws.String(notificationID),
+		QueueArn: aws.String(jobQueueArn),
+		Events:   aws.StringSlice(notificationEvents),
+	})
+
+	if _, err := p.s3Svc.PutBucketNotificationConfiguration(&s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(p.bucket),
+		NotificationConfiguration: config,
+	}); err != nil {
+		return fmt.Errorf("unable to set bucket %s notification configuration, %v", p.bucket, err)
+	}
+
+	if len(jobQueueConfigs) > 0 {
+		fmt.Println("updated bucket", p.bucket, "notifications to", jobQueueArn)
+	} else {
+		fmt.Println("configured bucket", p.bucket, "notifications to", jobQueueArn)
+	}
+	return nil
+}
+
+// isJobNotification returns if the queue configuration sends exactly the
+// notification events, for all keys of the bucket.
+func isJobNotification(queueConfig *s3.QueueConfiguration) bool {
+	if f := queueConfig.Filter; f != nil && f.Key != nil && len(f.Key.FilterRules) > 0 {
+		return false
+	}
+
+	events := map[string]bool{}
+	for _, event := range aws.StringValueSlice(queueConfig.Events) {
+		events[event] = true
+	}
+	if len(events) != len(notificationEvents) {
+		return false
+	}
+	for _, event := range notificationEvents {
+		if !events[event] {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteBucket deletes all objects in the upload bucket, including all of
+// their versions, and the bucket.
+func (p *provisioner) deleteBucket() error {
+	exists, err := p.bucketExists()
+	if err != nil {
+		return fmt.Errorf("unable to check bucket %s, %v", p.bucket, err)
+	}
+	if !exists {
+		fmt.Println("bucket", p.bucket, "does not exist")
+		return nil
+	}
+
+	// Every version, and delete marker, of the objects are deleted so
+	// versioned buckets are empty. Unversioned objects are listed with a
+	// null version ID.
+	batcher := s3manager.NewBatchDeleteWithClient(p.s3Svc)
+	var deleteErr error
+	err = p.s3Svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(p.bucket),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		objects := []s3manager.BatchDeleteObject{}
+		for _, v := range page.Versions {
+			objects = append(objects, p.deleteVersionObject(v.Key, v.VersionId))
+		}
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, p.deleteVersionObject(m.Key, m.VersionId))
+		}
+		deleteErr = batcher.Delete(aws.BackgroundContext(), &s3manager.DeleteObjectsIterator{Objects: objects})
+		return deleteErr == nil
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete bucket %s objects, %v", p.bucket, err)
+	}
+	if _, err := p.s3Svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(p.bucket)}); err != nil {
+		return fmt.Errorf("unable to delete bucket %s, %v", p.bucket, err)
+	}
+
+	fmt.Println("deleted bucket", p.bucket)
+	return nil
+}
+
+// deleteVersionObject returns the batch delete of the version of the object.
+func (p *provisioner) deleteVersionObject(key, versionID *string) s3manager.BatchDeleteObject {
+	return s3manager.BatchDeleteObject{Object: &s3.DeleteObjectInput{
+		Bucket:    aws.String(p.bucket),
+		Key:       key,
+		VersionId: versionID,
+	}}
+}
+
+// bucketExists returns if the bucket exists, and is accessible.
+func (p *provisioner) bucketExists() (bool, error) {
+	_, err := p.s3Svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(p.bucket)})
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return false, nil
+	}
+	return err == nil, err
+}
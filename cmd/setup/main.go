@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Provisions the resources the Word Frequency service needs. The upload bucket,
+// the job and result SQS queues, the bucket's notification configuration to send
+// S3 events to the job queue, and the DynamoDB result table. Optionally the job
+// history, and aggregate word count tables are also created. Resources which
+// already exist are verified instead of created, so the command can be run
+// multiple times. With the -teardown flag all of the resources are deleted
+// instead.
+//
+// Usage:
+//  setup [flags] <bucket> <job queue name> <result queue name> <tablename>
+func main() {
+	historyTable := flag.String("history-table", "", "name of the job history table to create, optional")
+	aggregateTable := flag.String("aggregate-table", "", "name of the aggregate word count table to create, optional")
+	billing := flag.String("billing", billingProvisioned, "DynamoDB billing mode, provisioned or on-demand")
+	readCapacity := flag.Int64("read-capacity", 1, "provisioned read capacity units of the tables")
+	writeCapacity := flag.Int64("write-capacity", 1, "provisioned write capacity units of the tables")
+	visibility := flag.Int64("visibility", 60, "visibility timeout in seconds of the job queue")
+	endpoint := flag.String("endpoint", "", "custom endpoint URL for all services, e.g. a local emulator")
+	teardown := flag.Bool("teardown", false, "delete all resources, including the bucket's objects, instead of creating them")
+	flag.Usage = func() {
+		fmt.Printf("usage: %s [flags] <bucket> <job queue name> <result queue name> <tablename>\n",
+			filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 4 || (*billing != billingProvisioned && *billing != billingOnDemand) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Create a session with the region and credentials provided by the
+	// environment. If a custom endpoint is provided all service clients will
+	// use it, with S3 path style addressing which emulators require.
+	cfg := &aws.Config{}
+	if *endpoint != "" {
+		cfg.Endpoint = aws.String(*endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess := session.New(cfg)
+
+	p := &provisioner{
+		s3Svc:    s3.New(sess),
+		sqsSvc:   sqs.New(sess),
+		dynamoDB: dynamodb.New(sess),
+		region:   aws.StringValue(sess.Config.Region),
+
+		bucket:         flag.Arg(0),
+		jobQueue:       flag.Arg(1),
+		resultQueue:    flag.Arg(2),
+		resultTable:    flag.Arg(3),
+		historyTable:   *historyTable,
+		aggregateTable: *aggregateTable,
+
+		billing:       *billing,
+		readCapacity:  *readCapacity,
+		writeCapacity: *writeCapacity,
+		visibility:    *visibility,
+	}
+
+	var err error
+	if *teardown {
+		err = p.teardown()
+	} else {
+		err = p.setup()
+	}
+	if err != nil {
+		fmt.Println("failed,", err)
+		os.Exit(1)
+	}
+}
+
+// A provisioner provides creating, verifying, and deleting the Word Frequency
+// service's resources.
+type provisioner struct {
+	s3Svc    *s3.S3
+	sqsSvc   *sqs.SQS
+	dynamoDB *dynamodb.DynamoDB
+	region   string
+
+	bucket, jobQueue, resultQueue string
+	resultTable, historyTable     string
+	aggregateTable                string
+
+	billing                     string
+	readCapacity, writeCapacity int64
+	visibility                  int64
+}
+
+// setup creates or verifies each of the resources. The bucket and job queue
+// must exist before the bucket's notification configuration can be set.
+func (p *provisioner) setup() error {
+	if err := p.setupBucket(); err != nil {
+		return err
+	}
+
+	jobQueueURL, err := p.setupQueue(p.jobQueue, p.visibility)
+	if err != nil {
+		return err
+	}
+	jobQueueArn, err := p.setupJobQueuePolicy(jobQueueURL)
+	if err != nil {
+		return err
+	}
+	resultQueueURL, err := p.setupQueue(p.resultQueue, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := p.setupNotification(jobQueueArn); err != nil {
+		return err
+	}
+
+	if err := p.setupTable(p.resultTable, resultTableSchema); err != nil {
+		return err
+	}
+	if p.historyTable != "" {
+		if err := p.setupTable(p.historyTable, historyTableSchema); err != nil {
+			return err
+		}
+	}
+	if p.aggregateTable != "" {
+		if err := p.setupTable(p.aggregateTable, aggregateTableSchema); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Environment ready, configure the worker with:")
+	fmt.Println("WORKER_QUEUE_URL=" + jobQueueURL)
+	fmt.Println("WORKER_RESULT_QUEUE_URL=" + resultQueueURL)
+	fmt.Println("WORKER_RESULT_TABLENAME=" + p.resultTable)
+	if p.historyTable != "" {
+		fmt.Println("WORKER_HISTORY_TABLENAME=" + p.historyTable)
+	}
+	if p.aggregateTable != "" {
+		fmt.Println("WORKER_AGGREGATE_TABLENAME=" + p.aggregateTable)
+	}
+	return nil
+}
+
+// teardown deletes each of the resources in the reverse order they were
+// created. Resources which do not exist are skipped.
+func (p *provisioner) teardown() error {
+	if p.aggregateTable != "" {
+		if err := p.deleteTable(p.aggregateTable); err != nil {
+			return err
+		}
+	}
+	if p.historyTable != "" {
+		if err := p.deleteTable(p.historyTable); err != nil {
+			return err
+		}
+	}
+	if err := p.deleteTable(p.resultTable); err != nil {
+		return err
+	}
+	if err := p.deleteQueue(p.resultQueue); err != nil {
+		return err
+	}
+	if err := p.deleteQueue(p.jobQueue); err != nil {
+		return err
+	}
+	return p.deleteBucket()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// setupQueue creates the SQS queue if it does not exist, and returns its URL.
+// If the visibility timeout is greater than zero it is set as the queue's
+// default visibility timeout.
+func (p *provisioner) setupQueue(name string, visibility int64) (string, error) {
+	if url, err := p.queueURL(name); err != nil {
+		return "", fmt.Errorf("unable to check queue %s, %v", name, err)
+	} else if url != "" {
+		fmt.Println("verified queue", name)
+		return url, nil
+	}
+
+	input := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+	if visibility > 0 {
+		input.Attributes = map[string]*string{
+			sqs.QueueAttributeNameVisibilityTimeout: aws.String(strconv.FormatInt(visibility, 10)),
+		}
+	}
+	resp, err := p.sqsSvc.CreateQueue(input)
+	if err != nil {
+		return "", fmt.Errorf("unable to create queue %s, %v", name, err)
+	}
+
+	fmt.Println("created queue", name)
+	return aws.StringValue(resp.QueueUrl), nil
+}
+
+// policyStatementID identifies the job queue's policy statement created by
+// this command.
+const policyStatementID = "AllowS3Notifications"
+
+// setupJobQueuePolicy adds a statement to the job queue's policy allowing the
+// upload bucket to send S3 event notifications to it, and returns the queue's
+// ARN. Other statements of an existing policy are preserved, and the policy is
+// left as it is if it already has the statement.
+func (p *provisioner) setupJobQueuePolicy(queueURL string) (string, error) {
+	resp, err := p.sqsSvc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{
+			sqs.QueueAttributeNameQueueArn, sqs.QueueAttributeNamePolicy,
+		}),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get queue %s attributes, %v", p.jobQueue, err)
+	}
+	queueArn := aws.StringValue(resp.Attributes[sqs.QueueAttributeNameQueueArn])
+
+	statement, err := normalizeJSON(map[string]interface{}{
+		"Sid":       policyStatementID,
+		"Effect":    "Allow",
+		"Principal": map[string]string{"Service": "s3.amazonaws.com"},
+		"Action":    "sqs:SendMessage",
+		"Resource":  queueArn,
+		"Condition": map[string]interface{}{
+			"ArnLike": map[string]string{"aws:SourceArn": "arn:aws:s3:::" + p.bucket},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+	statements := []interface{}{}
+	if v := aws.StringValue(resp.Attributes[sqs.QueueAttributeNamePolicy]); v != "" {
+		if err := json.Unmarshal([]byte(v), &policy); err != nil {
+			return "", fmt.Errorf("unable to parse queue %s policy, %v", p.jobQueue, err)
+		}
+		// A policy's Statement can be a single statement, or a list.
+		switch st := policy["Statement"].(type) {
+		case []interface{}:
+			statements = st
+		case nil:
+		default:
+			statements = []interface{}{st}
+		}
+	}
+
+	for _, existing := range statements {
+		m, _ := existing.(map[string]interface{})
+		if m["Sid"] != policyStatementID {
+			continue
+		}
+		if !reflect.DeepEqual(m, statement) {
+			return "", fmt.Errorf("queue %s policy already has a %s statement for another bucket or queue, remove it, or use another queue",
+				p.jobQueue, policyStatementID)
+		}
+		fmt.Println("verified queue", p.jobQueue, "policy")
+		return queueArn, nil
+	}
+
+	policy["Statement"] = append(statements, statement)
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.sqsSvc.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNamePolicy: aws.String(string(b)),
+		},
+	}); err != nil {
+		return "", fmt.Errorf("unable to set queue %s policy, %v", p.jobQueue, err)
+	}
+
+	fmt.Println("added statement to queue", p.jobQueue, "policy")
+	return queueArn, nil
+}
+
+// normalizeJSON returns the value as it is decoded from JSON, so it can be
+// compared with decoded JSON documents.
+func normalizeJSON(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// deleteQueue deletes the SQS queue if it exists.
+func (p *provisioner) deleteQueue(name string) error {
+	url, err := p.queueURL(name)
+	if err != nil {
+		return fmt.Errorf("unable to check queue %s, %v", name, err)
+	}
+	if url == "" {
+		fmt.Println("queue", name, "does not exist")
+		return nil
+	}
+
+	if _, err := p.sqsSvc.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(url)}); err != nil {
+		return fmt.Errorf("unable to delete queue %s, %v", name, err)
+	}
+
+	fmt.Println("deleted queue", name)
+	return nil
+}
+
+// queueURL returns the URL of the queue, or an empty string if the queue does
+// not exist.
+func (p *provisioner) queueURL(name string) (string, error) {
+	resp, err := p.sqsSvc.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sqs.ErrCodeQueueDoesNotExist {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.QueueUrl), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// DynamoDB billing modes the tables can be created with.
+const (
+	billingProvisioned = "provisioned"
+	billingOnDemand    = "on-demand"
+)
+
+// A tableSchema is the key schema of a table. Key attributes are strings.
+type tableSchema struct {
+	hashKey, rangeKey string
+}
+
+var (
+	// resultTableSchema is the schema of the table the worker records job
+	// results to.
+	resultTableSchema = tableSchema{hashKey: "Filename"}
+
+	// historyTableSchema is the schema of the table the worker records every
+	// job attempt to.
+	historyTableSchema = tableSchema{
+		hashKey:  "Filename",
+		rangeKey: wordfreq.HistoryAttemptAttr,
+	}
+
+	// aggregateTableSchema is the schema of the table the worker records
+	// aggregate word counts to.
+	aggregateTableSchema = tableSchema{
+		hashKey:  wordfreq.AggregateScopeAttr,
+		rangeKey: wordfreq.AggregateWordAttr,
+	}
+)
+
+// setupTable creates the table with the schema if it does not exist, and
+// waits for the table to be ACTIVE. If the table exists its key schema is
+// verified to match the schema.
+func (p *provisioner) setupTable(tableName string, schema tableSchema) error {
+	desc, err := p.describeTable(tableName)
+	if err != nil {
+		return fmt.Errorf("unable to check table %s, %v", tableName, err)
+	}
+	if desc != nil {
+		if err := schema.verify(desc); err != nil {
+			return fmt.Errorf("table %s exists, but %v", tableName, err)
+		}
+	} else {
+		// Tables which do not exist are created in the session's region.
+		if _, err := p.dynamoDB.CreateTable(p.createTableInput(tableName, schema)); err != nil {
+			return fmt.Errorf("unable to create table %s, %v", tableName, err)
+		}
+	}
+
+	// Tables can only be used once they are ACTIVE.
+	if err := p.dynamoDB.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	}); err != nil {
+		return fmt.Errorf("table %s not active, %v", tableName, err)
+	}
+
+	if desc != nil {
+		fmt.Println("verified table", tableName)
+	} else {
+		fmt.Println("created table", tableName)
+	}
+	return nil
+}
+
+// createTableInput returns the CreateTable input for the table, with the
+// provisioner's billing mode.
+func (p *provisioner) createTableInput(tableName string, schema tableSchema) *dynamodb.CreateTableInput {
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(schema.hashKey),
+				AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(schema.hashKey),
+				KeyType:       aws.String(dynamodb.KeyTypeHash),
+			},
+		},
+	}
+	if schema.rangeKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(schema.rangeKey),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		})
+		input.KeySchema = append(input.KeySchema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(schema.rangeKey),
+			KeyType:       aws.String(dynamodb.KeyTypeRange),
+		})
+	}
+
+	if p.billing == billingOnDemand {
+		input.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	} else {
+		input.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+		input.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(p.readCapacity),
+			WriteCapacityUnits: aws.Int64(p.writeCapacity),
+		}
+	}
+
+	return input
+}
+
+// deleteTable deletes the table if it exists, and waits for it to be deleted.
+func (p *provisioner) deleteTable(tableName string) error {
+	desc, err := p.describeTable(tableName)
+	if err != nil {
+		return fmt.Errorf("unable to check table %s, %v", tableName, err)
+	}
+	if desc == nil {
+		fmt.Println("table", tableName, "does not exist")
+		return nil
+	}
+
+	if _, err := p.dynamoDB.DeleteTable(&dynamodb.DeleteTableInput{
+		TableName: aws.String(tableName),
+	}); err != nil {
+		return fmt.Errorf("unable to delete table %s, %v", tableName, err)
+	}
+	if err := p.dynamoDB.WaitUntilTableNotExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	}); err != nil {
+		return fmt.Errorf("table %s not deleted, %v", tableName, err)
+	}
+
+	fmt.Println("deleted table", tableName)
+	return nil
+}
+
+// describeTable returns the description of the table, or nil if the table
+// does not exist.
+func (p *provisioner) describeTable(tableName string) (*dynamodb.TableDescription, error) {
+	resp, err := p.dynamoDB.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return resp.Table, nil
+}
+
+// verify returns an error if the table's key schema does not match.
+func (s tableSchema) verify(desc *dynamodb.TableDescription) error {
+	hashKey, rangeKey := "", ""
+	for _, key := range desc.KeySchema {
+		switch aws.StringValue(key.KeyType) {
+		case dynamodb.KeyTypeHash:
+			hashKey = aws.StringValue(key.AttributeName)
+		case dynamodb.KeyTypeRange:
+			rangeKey = aws.StringValue(key.AttributeName)
+		}
+	}
+	if hashKey != s.hashKey || rangeKey != s.rangeKey {
+		return fmt.Errorf("has key schema %q, %q, expected %q, %q",
+			hashKey, rangeKey, s.hashKey, s.rangeKey)
+	}
+	return nil
+}
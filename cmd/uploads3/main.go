@@ -1,139 +1,155 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/sqs"
-	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
-// Uploads a file to S3 so it can be processed by the Word Frequency service.
-// If a "WORKER_RESULT_QUEUE_URL" environment variable is provided the upload
-// client will wait for the job to processed, and print the results to the console.
+// Uploads files to S3 so they can be processed by the Word Frequency service.
+// Files, glob patterns, and directories can be provided. Directories are
+// uploaded recursively, with the relative path of each file used as its key.
+// The key of a single file can be set explicitly, or a key prefix and unique
+// suffix can be added to the keys of all files, but not both.
+//
+// Each object is tagged with a correlation ID which the worker includes in the
+// job's result. The client can wait for the results, and print them to the
+// console, by either creating a temporary reply queue the worker will send the
+// results to, or by polling the DynamoDB result table. If a
+// "WORKER_RESULT_QUEUE_URL" environment variable is provided, and the wait
+// flag is not, the client will wait using a reply queue. Results are printed
+// in the format selected by the format flag. When a JSON or CSV format is
+// selected, progress messages are written to stderr so the results can be
+// piped to other programs.
 //
 // Usage:
-//  uploads3 <bucket> <filename>
+//  uploads3 [-concurrency n] [-key key] [-prefix prefix] [-unique timestamp|uuid]
+//      [-wait none|queue|table] [-table tablename] [-timeout duration]
+//      [-format table|json|csv|markdown|bars]
+//      <bucket> <filename|pattern|directory>...
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Printf("usage: %s <bucket> <filename>\n", filepath.Base(os.Args[0]))
+	concurrency := flag.Int("concurrency", 4, "number of files to upload at once")
+	key := flag.String("key", "", "key to upload a single file to, instead of its name")
+	prefix := flag.String("prefix", "", "prefix added to the key of each file")
+	unique := flag.String("unique", uniqueNone, "unique suffix added to the key of each file, timestamp or uuid")
+	wait := flag.String("wait", "", "wait for results using a reply queue, or by polling the result table, none, queue, or table")
+	tableName := flag.String("table", os.Getenv("WORKER_RESULT_TABLENAME"), "DynamoDB result table to poll when waiting with table")
+	timeout := flag.Duration("timeout", 10*time.Minute, "maximum amount of time to wait for results")
+	format := flag.String("format", wordfreq.FormatTable, "format results are printed in, table, json, csv, markdown, or bars")
+	flag.Usage = func() {
+		fmt.Printf("usage: %s [flags] <bucket> <filename|pattern|directory>...\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *wait == "" {
+		*wait = waitNone
+		if os.Getenv("WORKER_RESULT_QUEUE_URL") != "" {
+			*wait = waitQueue
+		}
+	}
+	if flag.NArg() < 2 || *concurrency <= 0 || !wordfreq.IsValidFormat(*format) ||
+		(*wait != waitNone && *wait != waitQueue && *wait != waitTable) ||
+		(*wait == waitTable && *tableName == "") {
+		flag.Usage()
 		os.Exit(1)
 	}
-	bucket := os.Args[1]
-	filename := os.Args[2]
+	bucket := flag.Arg(0)
 
-	file, err := os.Open(filename)
+	progress := os.Stdout
+	if *format == wordfreq.FormatJSON || *format == wordfreq.FormatCSV {
+		progress = os.Stderr
+	}
+
+	uploads, err := collectUploads(flag.Args()[1:])
 	if err != nil {
-		fmt.Println("Failed to open file", filename, err)
+		fmt.Fprintln(progress, "Failed to collect files", err)
+		os.Exit(1)
+	}
+	if err := setKeys(uploads, *key, *prefix, *unique); err != nil {
+		fmt.Fprintln(progress, "Invalid key options", err)
+		flag.Usage()
 		os.Exit(1)
 	}
-	defer file.Close()
+	for _, u := range uploads {
+		if u.CorrelationID, err = newUUID(); err != nil {
+			fmt.Fprintln(progress, "Failed to create correlation ID", err)
+			os.Exit(1)
+		}
+	}
 
 	// Create a session which contains the default configurations for the SDK.
 	// Use the session to create the service clients to make API calls to AWS.
 	sess := session.New()
 
-	// Create S3 Uploader manager to concurrently upload the file
-	svc := s3manager.NewUploader(sess)
-
-	fmt.Println("Uploading file to S3...")
-	result, err := svc.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(filepath.Base(filename)),
-		Body:   file,
-	})
-	if err != nil {
-		fmt.Println("error", err)
-		os.Exit(1)
+	// The reply queue must exist before the files are uploaded, since the
+	// worker could process the jobs before the uploads all complete.
+	var replyQueueURL string
+	if *wait == waitQueue {
+		id, err := newUUID()
+		if err == nil {
+			replyQueueURL, err = createReplyQueue(sqs.New(sess), id)
+		}
+		if err != nil {
+			fmt.Fprintln(progress, "Failed to create reply queue", err)
+			os.Exit(1)
+		}
 	}
 
-	fmt.Printf("Successfully uploaded %s to %s\n", filename, result.Location)
+	// Create S3 Uploader manager to concurrently upload the files
+	svc := s3manager.NewUploader(sess)
 
-	if queueURL := os.Getenv("WORKER_RESULT_QUEUE_URL"); queueURL != "" {
-		fmt.Println("Waiting for results...")
-		waitForResult(sqs.New(sess), bucket, filepath.Base(filename), queueURL)
-	}
-}
+	fmt.Fprintf(progress, "Uploading %d file(s) to S3...\n", len(uploads))
+	uploadFiles(svc, bucket, replyQueueURL, uploads, *concurrency)
 
-// waitForResult waits for the job to be processed and the job result to be added
-// to the job result SQS queue.  This will pool the SQS queue for job results until
-// a job result matches the file it uploaded. When a match is found the job result
-// will also be deleted from the queue, and its status written to the console.
-// If the job result doesn't match the file uploaded by this client, the message
-// will be ignored, so another client could received it.
-func waitForResult(svc sqsiface.SQSAPI, bucket, filename, resultQueueURL string) {
-	for {
-		resp, err := svc.ReceiveMessage(&sqs.ReceiveMessageInput{
-			QueueUrl:          aws.String(resultQueueURL),
-			VisibilityTimeout: aws.Int64(0),
-			WaitTimeSeconds:   aws.Int64(20),
-		})
-		if err != nil {
-			log.Println("Failed to receive message", err)
-			time.Sleep(30 * time.Second)
+	numUploaded := 0
+	for _, u := range uploads {
+		if u.Err != nil {
+			fmt.Fprintln(progress, "Failed to upload", u.Filename, u.Err)
 			continue
 		}
+		numUploaded++
+		fmt.Fprintf(progress, "Successfully uploaded %s to %s\n", u.Filename, u.Location)
+	}
 
-		for _, msg := range resp.Messages {
-			result := &wordfreq.JobResult{}
-			if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), result); err != nil {
-				log.Println("Failed to unmarshal message", err)
-				continue
-			}
+	if *wait != waitNone && numUploaded > 0 {
+		fmt.Fprintln(progress, "Waiting for results...")
+		if *wait == waitQueue {
+			waitForReplies(sqs.New(sess), replyQueueURL, uploads, *timeout)
+		} else {
+			pollResultTable(dynamodb.New(sess), *tableName, bucket, uploads, *timeout)
+		}
 
-			if result.Job.Bucket != bucket || result.Job.Key != filename {
-				continue
+		results := []*wordfreq.JobResult{}
+		for _, u := range uploads {
+			if u.Result != nil {
+				results = append(results, u.Result)
 			}
-
-			printResult(result)
-			svc.DeleteMessage(&sqs.DeleteMessageInput{
-				QueueUrl:      aws.String(resultQueueURL),
-				ReceiptHandle: msg.ReceiptHandle,
-			})
-			return
 		}
-	}
-}
-
-// printResult prints the job results to the console.
-func printResult(result *wordfreq.JobResult) {
-	fmt.Printf("Job Results completed in %s for %s/%s\n",
-		printDuration(result.Duration), result.Job.Bucket, result.Job.Key)
-	if result.Status == wordfreq.JobCompleteFailure {
-		fmt.Println("Failed:", result.StatusMessage)
-		return
+		if err := wordfreq.WriteResults(os.Stdout, *format, results); err != nil {
+			fmt.Fprintln(progress, "Failed to print results", err)
+		}
+		if len(uploads) > 1 || len(results) == 0 {
+			printSummary(progress, uploads)
+		}
 	}
 
-	fmt.Println("Top Words:")
-	for _, w := range result.Words {
-		format := "- %s\t%d\n"
-		if len(w.Word) <= 5 {
-			format = "- %s\t\t%d\n"
-		}
-		fmt.Printf(format, w.Word, w.Count)
+	// The reply queue is only used by this client, and is no longer needed.
+	if replyQueueURL != "" {
+		sqs.New(sess).DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(replyQueueURL)})
 	}
-}
 
-// printDuration formats the duration trimming less significant units based on
-// the overall duration provided.  Minutes will be limit to seconds. Seconds to
-// milliseconds. Milliseconds to microseconds.
-func printDuration(dur time.Duration) string {
-	nano := dur.Nanoseconds()
-	if dur > time.Minute {
-		nano = (nano / 1e9) * 1e9
-	} else if dur > time.Second {
-		nano = (nano / 1e6) * 1e6
-	} else if dur > time.Millisecond {
-		nano = (nano / 1e3) * 1e3
+	if numUploaded != len(uploads) {
+		os.Exit(1)
 	}
-	return time.Duration(nano).String()
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// Ways the uploads3 command can wait for job results.
+const (
+	waitNone  = "none"
+	waitQueue = "queue"
+	waitTable = "table"
+)
+
+// tablePollInterval is the amount of time between polls of the result table.
+const tablePollInterval = 5 * time.Second
+
+// createReplyQueue creates a temporary SQS queue only this client will receive
+// job results from. The queue should be deleted once all results are received.
+func createReplyQueue(svc sqsiface.SQSAPI, id string) (string, error) {
+	resp, err := svc.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String("wordfreq-reply-" + id),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.QueueUrl), nil
+}
+
+// waitForReplies waits for the jobs to be processed and the job results to be
+// sent to the client's reply queue. Results are matched to the uploaded files
+// by the correlation ID message attribute, and set on the file's upload. Since
+// the reply queue is only used by this client every message is deleted once
+// received. Returns when all results are received, or the timeout elapses.
+func waitForReplies(svc sqsiface.SQSAPI, replyQueueURL string, uploads []*upload, timeout time.Duration) {
+	pending := pendingUploads(uploads)
+	deadline := time.Now().Add(timeout)
+
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		wait := int64(time.Until(deadline) / time.Second)
+		if wait > 20 {
+			wait = 20
+		}
+		resp, err := svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(replyQueueURL),
+			WaitTimeSeconds:       aws.Int64(wait),
+			MaxNumberOfMessages:   aws.Int64(10),
+			MessageAttributeNames: aws.StringSlice([]string{wordfreq.CorrelationIDAttribute}),
+		})
+		if err != nil {
+			log.Println("Failed to receive message", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, msg := range resp.Messages {
+			svc.DeleteMessage(&sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(replyQueueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+
+			attr, ok := msg.MessageAttributes[wordfreq.CorrelationIDAttribute]
+			if !ok {
+				continue
+			}
+			u, ok := pending[aws.StringValue(attr.StringValue)]
+			if !ok {
+				continue
+			}
+
+			result := &wordfreq.JobResult{}
+			if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), result); err != nil {
+				log.Println("Failed to unmarshal message", err)
+				continue
+			}
+			u.Result = result
+			delete(pending, u.CorrelationID)
+		}
+	}
+}
+
+// pollResultTable waits for the jobs to be processed by polling the DynamoDB
+// result table for the result item of each uploaded file. A result item only
+// matches an upload once it has the upload's correlation ID, and the job is
+// complete. Failed results which will be retried are not complete. Returns when
+// all results are received, or the timeout elapses.
+func pollResultTable(svc dynamodbiface.DynamoDBAPI, tableName, bucket string, uploads []*upload, timeout time.Duration) {
+	pending := pendingUploads(uploads)
+	deadline := time.Now().Add(timeout)
+
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(tablePollInterval)
+
+		for id, u := range pending {
+			resp, err := svc.GetItem(&dynamodb.GetItemInput{
+				TableName: aws.String(tableName),
+				Key: map[string]*dynamodb.AttributeValue{
+					"Filename": {S: aws.String(path.Join(bucket, u.Key))},
+				},
+				ConsistentRead: aws.Bool(true),
+			})
+			if err != nil {
+				log.Println("Failed to get result", err)
+				continue
+			}
+			if resp.Item == nil {
+				continue
+			}
+
+			record := wordfreq.ResultRecord{}
+			if err := dynamodbattribute.ConvertFromMap(resp.Item, &record); err != nil {
+				log.Println("Failed to unmarshal result", err)
+				continue
+			}
+			result := record.JobResult()
+			if record.CorrelationID != id ||
+				(result.Status == wordfreq.JobCompleteFailure && result.ErrorCode.Retryable()) {
+				continue
+			}
+
+			u.Result = result
+			delete(pending, id)
+		}
+	}
+}
+
+// pendingUploads returns the successful uploads keyed by their correlation ID.
+func pendingUploads(uploads []*upload) map[string]*upload {
+	pending := map[string]*upload{}
+	for _, u := range uploads {
+		if u.Err == nil {
+			pending[u.CorrelationID] = u
+		}
+	}
+	return pending
+}
+
+// printSummary prints a table of each file uploaded, the status of its job,
+// and the job's duration. Followed by the number of jobs which succeeded and
+// failed.
+func printSummary(out io.Writer, uploads []*upload) {
+	succeeded, failed := 0, 0
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tKEY\tSTATUS\tDURATION\tMESSAGE")
+	for _, u := range uploads {
+		status, duration, message := "upload failed", "-", ""
+		if u.Err != nil {
+			message = u.Err.Error()
+		} else if u.Result != nil {
+			status = string(u.Result.Status)
+			duration = wordfreq.FormatDuration(u.Result.Duration)
+			message = u.Result.StatusMessage
+		} else {
+			status = "timed out"
+		}
+		if u.Result != nil && u.Result.Status == wordfreq.JobCompleteSuccess {
+			succeeded++
+		} else {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.Filename, u.Key, status, duration, message)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "%d succeeded, %d failed\n", succeeded, failed)
+}
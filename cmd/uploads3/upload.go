@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// An upload is a local file to be uploaded to S3, and its progress.
+type upload struct {
+	// Local path of the file, and the key it is uploaded to.
+	Filename string
+	Key      string
+	// ID the file's object is tagged with, and its job result will include.
+	CorrelationID string
+
+	// Location the file was uploaded to, or error if the upload failed.
+	Location string
+	Err      error
+
+	// Result of the job processing the uploaded file.
+	Result *wordfreq.JobResult
+}
+
+// collectUploads expands the paths into the files to upload. Paths can be
+// files, glob patterns, or directories. Directories are walked recursively,
+// and the directory's name followed by the path of each file relative to the
+// directory is its key, so the directory structure is preserved as key
+// prefixes. Directories without a name, such as . and .., add no prefix. Files are uploaded
+// with their base name as their key.
+func collectUploads(paths []string) ([]*upload, error) {
+	uploads := []*upload{}
+	seen := map[string]bool{}
+
+	for _, pattern := range paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if !seen[match] {
+					seen[match] = true
+					uploads = append(uploads, &upload{Filename: match, Key: filepath.Base(match)})
+				}
+				continue
+			}
+
+			// Keys are relative to the directory, prefixed with its name.
+			// Directories without a name, such as . and .., add no prefix,
+			// so keys never contain parent directory segments.
+			dir := filepath.Clean(match)
+			name := filepath.Base(dir)
+			if name == "." || name == ".." || name == string(filepath.Separator) {
+				name = ""
+			}
+			err = filepath.Walk(match, func(filename string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() || seen[filename] {
+					return err
+				}
+				rel, err := filepath.Rel(dir, filename)
+				if err != nil {
+					return err
+				}
+				key := path.Join(name, filepath.ToSlash(rel))
+				if key == ".." || strings.HasPrefix(key, "../") {
+					return fmt.Errorf("%s is outside of %s", filename, match)
+				}
+				seen[filename] = true
+				uploads = append(uploads, &upload{Filename: filename, Key: key})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Files uploaded to the same key would overwrite each other.
+	keys := map[string]string{}
+	for _, u := range uploads {
+		if other, ok := keys[u.Key]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded to %s", other, u.Filename, u.Key)
+		}
+		keys[u.Key] = u.Filename
+	}
+
+	return uploads, nil
+}
+
+// Unique key suffixes which can be added to the keys of uploaded files.
+const (
+	uniqueNone      = ""
+	uniqueTimestamp = "timestamp"
+	uniqueUUID      = "uuid"
+)
+
+// setKeys updates the key of each upload. If an explicit key is provided it
+// is used as the key of the only upload, and can not be combined with a prefix
+// or unique suffix. Otherwise the key prefix is added to each key, and if
+// requested a unique suffix is inserted before each key's extension so uploads
+// of files with the same name do not overwrite each other.
+func setKeys(uploads []*upload, key, prefix, unique string) error {
+	switch unique {
+	case uniqueNone, uniqueTimestamp, uniqueUUID:
+	default:
+		return fmt.Errorf("unknown unique key suffix %s", unique)
+	}
+
+	if key != "" {
+		if prefix != "" || unique != uniqueNone {
+			return fmt.Errorf("key can not be combined with a prefix or unique suffix")
+		}
+		if len(uploads) != 1 {
+			return fmt.Errorf("key can only be set when uploading a single file")
+		}
+		uploads[0].Key = key
+		return nil
+	}
+
+	for _, u := range uploads {
+		var suffix string
+		switch unique {
+		case uniqueTimestamp:
+			ts, err := newTimestampSuffix(time.Now())
+			if err != nil {
+				return err
+			}
+			suffix = ts
+		case uniqueUUID:
+			id, err := newUUID()
+			if err != nil {
+				return err
+			}
+			suffix = id
+		}
+
+		if suffix != "" {
+			ext := path.Ext(u.Key)
+			u.Key = strings.TrimSuffix(u.Key, ext) + "-" + suffix + ext
+		}
+		u.Key = prefix + u.Key
+	}
+
+	return nil
+}
+
+// newTimestampSuffix returns a unique key suffix of the time, to the
+// millisecond, followed by a random component so files uploaded at the same
+// time, even by different clients, have different suffixes.
+func newTimestampSuffix(t time.Time) (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%03dZ-%x", t.UTC().Format("20060102T150405"), t.Nanosecond()/int(time.Millisecond), b), nil
+}
+
+// newUUID returns a random, version 4, UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// uploadFiles uploads the files to the bucket, with at most concurrency files
+// being uploaded at once. The location or error of each upload is set on the
+// upload. If a reply to queue URL is provided the worker will send the job
+// results to that queue.
+func uploadFiles(svc *s3manager.Uploader, bucket, replyTo string, uploads []*upload, concurrency int) {
+	var wg sync.WaitGroup
+	uploadCh := make(chan *upload)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range uploadCh {
+				u.Location, u.Err = uploadFile(svc, bucket, replyTo, u)
+			}
+		}()
+	}
+
+	for _, u := range uploads {
+		uploadCh <- u
+	}
+	close(uploadCh)
+	wg.Wait()
+}
+
+// uploadFile uploads a single file to the bucket, returning its location. The
+// object is tagged with the upload's correlation ID, and the reply to queue URL
+// if set, so the worker can deliver the job's result directly to this client.
+func uploadFile(svc *s3manager.Uploader, bucket, replyTo string, u *upload) (string, error) {
+	file, err := os.Open(u.Filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	metadata := map[string]*string{
+		wordfreq.CorrelationIDMetadata: aws.String(u.CorrelationID),
+	}
+	if replyTo != "" {
+		metadata[wordfreq.ReplyToMetadata] = aws.String(replyTo)
+	}
+
+	result, err := svc.Upload(&s3manager.UploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(u.Key),
+		Body:     file,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.Location, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollectUploadsKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wordfreq-test-")
+	if err != nil {
+		t.Fatalf("expect no error creating temp dir, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// dir/top.txt, dir/docs/a.txt, dir/docs/nested/b.txt, and dir/work is
+	// the working directory.
+	for _, name := range []string{"top.txt", "docs/a.txt", "docs/nested/b.txt", "work/c.txt"} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatalf("expect no error creating dir, got %v", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("words"), 0644); err != nil {
+			t.Fatalf("expect no error writing file, got %v", err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("expect no error getting working dir, got %v", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(dir, "work")); err != nil {
+		t.Fatalf("expect no error changing dir, got %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		paths      []string
+		expectKeys []string
+	}{
+		{name: "current dir", paths: []string{"."},
+			expectKeys: []string{"c.txt"}},
+		{name: "parent dir", paths: []string{".."},
+			expectKeys: []string{"docs/a.txt", "docs/nested/b.txt", "top.txt", "work/c.txt"}},
+		{name: "parent sub dir", paths: []string{"../docs"},
+			expectKeys: []string{"docs/a.txt", "docs/nested/b.txt"}},
+		{name: "parent sub dir trailing slash", paths: []string{"../docs/nested/"},
+			expectKeys: []string{"nested/b.txt"}},
+		{name: "parent file", paths: []string{"../top.txt"},
+			expectKeys: []string{"top.txt"}},
+		{name: "parent pattern", paths: []string{"../docs/*"},
+			expectKeys: []string{"a.txt", "nested/b.txt"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			uploads, err := collectUploads(c.paths)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			keys := []string{}
+			for _, u := range uploads {
+				keys = append(keys, u.Key)
+			}
+			sort.Strings(keys)
+			if e, a := c.expectKeys, keys; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect keys %v, got %v", e, a)
+			}
+		})
+	}
+}
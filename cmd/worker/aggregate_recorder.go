@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+const (
+	// maxTransactItems is the maximum number of actions in a DynamoDB transaction.
+	maxTransactItems = 100
+	// maxRangeKeyLen is the maximum length in bytes of a DynamoDB range key.
+	maxRangeKeyLen = 1024
+	// maxKeywordBatch is the number of words whose document frequencies are
+	// read at once. One less than the BatchGetItem limit, since the scope's
+	// number of documents is also read.
+	maxKeywordBatch = 99
+	// maxKeywordCandidates is the number of the job's most common words
+	// scored as keywords. Each batch of maxKeywordBatch candidates is one
+	// BatchGetItem request, so at most 11 requests are made for each job.
+	maxKeywordCandidates = 1000
+	// aggregateOptionsAttr is the attribute of an object version's documents
+	// marker with the options its words were counted with.
+	aggregateOptionsAttr = "Options"
+)
+
+// An AggregateRecorder provides adding the word counts of each job to the
+// corpus wide word counts of the job's aggregate scopes in DynamoDB. The
+// number of documents in each scope, and the number of documents each word
+// occurs in, are also recorded so keywords can be scored by TF-IDF.
+//
+// Counts are added with UpdateItem ADD in transactions. Each transaction
+// includes a marker item for the object version and the transaction's chunk of
+// words, which can only be written once. If the same object version is
+// processed again the marker's condition will fail, and the transaction will
+// not be applied, so the words are not counted twice.
+//
+// Which words are counted, and so the words of each chunk, depend on the
+// options the object was counted with. The first transaction's documents
+// marker records the options, and each later chunk is only applied if the
+// options match. An object version processed again with different options is
+// not added again, even if only some of its chunks were applied.
+type AggregateRecorder struct {
+	tableName string
+	svc       dynamodbiface.DynamoDBAPI
+}
+
+// NewAggregateRecorder creates a new instance of the AggregateRecorder
+// configured with a DynamoDB service client.
+func NewAggregateRecorder(tableName string, svc dynamodbiface.DynamoDBAPI) *AggregateRecorder {
+	return &AggregateRecorder{
+		tableName: tableName,
+		svc:       svc,
+	}
+}
+
+// Record adds the counts of the words counted for the job to the aggregate
+// counts of the job's scopes. Words are added in chunks in a repeatable order
+// so that the chunks are the same each time the object version is processed
+// with the same options. Counts spilled to disk are streamed, instead of being
+// read into memory.
+func (a *AggregateRecorder) Record(job *wordfreq.Job, counts *wordfreq.WordCounts) error {
+	identity := objectVersionIdentity(job)
+	if identity == "" {
+		return fmt.Errorf("no version, ETag, or sequencer to identify object by")
+	}
+
+	scopes := wordfreq.AggregateScopes(job.Bucket, job.Key)
+	// Each chunk's transaction also has its marker, and the condition on the
+	// documents marker.
+	chunkSize := (maxTransactItems - 2) / len(scopes)
+	markerScope := "applied#" + path.Join(job.Bucket, job.Key)
+	options := aggregateOptions(job, counts)
+
+	// The object is added to the number of documents of each scope once,
+	// with its own marker, which records the options the words are counted
+	// with.
+	documentsMarker := map[string]*dynamodb.AttributeValue{
+		wordfreq.AggregateScopeAttr: {S: aws.String(markerScope)},
+		wordfreq.AggregateWordAttr:  {S: aws.String(identity + "#documents")},
+	}
+	marker := map[string]*dynamodb.AttributeValue{
+		aggregateOptionsAttr: {S: aws.String(options)},
+	}
+	for k, v := range documentsMarker {
+		marker[k] = v
+	}
+	documents := wordfreq.Words{{Word: wordfreq.AggregateDocumentsWord}}
+	if err := a.applyChunk(marker, nil, scopes, documents); err != nil {
+		return err
+	}
+
+	// The documents marker may have been written by an earlier attempt with
+	// different options, whose chunks can not be repeated.
+	recorded, err := a.recordedOptions(documentsMarker)
+	if err != nil {
+		return err
+	}
+	if recorded != options {
+		infoLog.Printf("Aggregates of %s %s were added with options %q, not adding words counted with %q\n",
+			path.Join(job.Bucket, job.Key), identity, recorded, options)
+		return nil
+	}
+	gate := &dynamodb.ConditionCheck{
+		TableName:           aws.String(a.tableName),
+		Key:                 documentsMarker,
+		ConditionExpression: aws.String("#options = :options"),
+		ExpressionAttributeNames: map[string]*string{
+			"#options": aws.String(aggregateOptionsAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":options": {S: aws.String(options)},
+		},
+	}
+
+	chunk, index := wordfreq.Words{}, 0
+	applyChunk := func() error {
+		marker := map[string]*dynamodb.AttributeValue{
+			wordfreq.AggregateScopeAttr: {S: aws.String(markerScope)},
+			wordfreq.AggregateWordAttr:  {S: aws.String(identity + "#" + strconv.Itoa(index))},
+		}
+		if err := a.applyChunk(marker, gate, scopes, chunk); err != nil {
+			return err
+		}
+		chunk, index = chunk[:0], index+1
+		return nil
+	}
+
+	err = eachAggregatableWord(counts, func(w wordfreq.Word) error {
+		chunk = append(chunk, w)
+		if len(chunk) < chunkSize {
+			return nil
+		}
+		return applyChunk()
+	})
+	if err != nil {
+		return err
+	}
+	if len(chunk) > 0 {
+		return applyChunk()
+	}
+	return nil
+}
+
+// applyChunk adds the counts of the words to the scopes in a transaction with
+// the marker item, and adds one to the number of documents each word occurs
+// in. If a gate is provided the transaction is only applied if its condition
+// is met. If the transaction is canceled because the marker already exists the
+// chunk was previously applied, and is skipped.
+func (a *AggregateRecorder) applyChunk(marker map[string]*dynamodb.AttributeValue, gate *dynamodb.ConditionCheck, scopes []string, words wordfreq.Words) error {
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(a.tableName),
+				Item:                marker,
+				ConditionExpression: aws.String("attribute_not_exists(#scope)"),
+				ExpressionAttributeNames: map[string]*string{
+					"#scope": aws.String(wordfreq.AggregateScopeAttr),
+				},
+			},
+		},
+	}
+	if gate != nil {
+		items = append(items, &dynamodb.TransactWriteItem{ConditionCheck: gate})
+	}
+	for _, scope := range scopes {
+		for _, w := range words {
+			// The document count item only counts documents, and has no
+			// word count.
+			updateExpr := "ADD #count :count, #documents :one"
+			names := map[string]*string{
+				"#count":     aws.String(wordfreq.AggregateCountAttr),
+				"#documents": aws.String(wordfreq.AggregateDocumentsAttr),
+			}
+			values := map[string]*dynamodb.AttributeValue{
+				":count": {N: aws.String(strconv.Itoa(w.Count))},
+				":one":   {N: aws.String("1")},
+			}
+			if w.Word == wordfreq.AggregateDocumentsWord {
+				updateExpr = "ADD #documents :one"
+				delete(names, "#count")
+				delete(values, ":count")
+			}
+
+			items = append(items, &dynamodb.TransactWriteItem{
+				Update: &dynamodb.Update{
+					TableName: aws.String(a.tableName),
+					Key: map[string]*dynamodb.AttributeValue{
+						wordfreq.AggregateScopeAttr: {S: aws.String(scope)},
+						wordfreq.AggregateWordAttr:  {S: aws.String(w.Word)},
+					},
+					UpdateExpression:          aws.String(updateExpr),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			})
+		}
+	}
+
+	_, err := a.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+		// The transaction may also be canceled by conflicts with other
+		// transactions, so check the marker to know if it was applied.
+		resp, getErr := a.svc.GetItem(&dynamodb.GetItemInput{
+			TableName: aws.String(a.tableName),
+			Key: map[string]*dynamodb.AttributeValue{
+				wordfreq.AggregateScopeAttr: marker[wordfreq.AggregateScopeAttr],
+				wordfreq.AggregateWordAttr:  marker[wordfreq.AggregateWordAttr],
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if getErr == nil && resp.Item != nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to add aggregate word counts, %v", err)
+	}
+
+	return nil
+}
+
+// recordedOptions returns the options recorded by the object version's
+// documents marker. Markers written without options return an empty string.
+func (a *AggregateRecorder) recordedOptions(documentsMarker map[string]*dynamodb.AttributeValue) (string, error) {
+	resp, err := a.svc.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(a.tableName),
+		Key:            documentsMarker,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get aggregate options, %v", err)
+	}
+	if resp.Item == nil {
+		return "", fmt.Errorf("aggregate documents marker not found")
+	}
+	return aws.StringValue(resp.Item[aggregateOptionsAttr].S), nil
+}
+
+// aggregateOptions returns the options which select the words counted for
+// the job, in the form recorded by the documents marker. The number of top
+// words does not change the words counted, so is not included. The charset is
+// the job's option, since without it the charset is chosen from the object's
+// version, which never changes.
+func aggregateOptions(job *wordfreq.Job, counts *wordfreq.WordCounts) string {
+	return fmt.Sprintf("min=%d,max=%d,long=%s,language=%s,charset=%s",
+		job.Options.MinWordLength, job.Options.MaxWordLength, job.Options.LongWordPolicy,
+		counts.Language, job.Options.Charset)
+}
+
+// Keywords scores the words counted for the job by TF-IDF, with the document
+// frequencies of the job's most specific aggregate scope, and returns the
+// job's top keywords. The job's words must already be recorded, so the job's
+// object is included in the document frequencies. The document frequencies
+// are read in batches as the words are scored.
+//
+// Reading the document frequency of every word would cost a request for each
+// maxKeywordBatch words of the job's vocabulary. Instead only the job's
+// maxKeywordCandidates most common words are scored. A less common word could
+// only score higher if it is much rarer in the scope, so the keywords of jobs
+// with larger vocabularies are approximate.
+func (a *AggregateRecorder) Keywords(job *wordfreq.Job, counts *wordfreq.WordCounts) (wordfreq.Keywords, error) {
+	scopes := wordfreq.AggregateScopes(job.Bucket, job.Key)
+	scope := scopes[len(scopes)-1]
+	collector := wordfreq.NewKeywordCollector(job.Options.Top)
+
+	// Candidates are collected by count, as keywords scored by their count.
+	candidates := wordfreq.NewKeywordCollector(maxKeywordCandidates)
+	err := eachAggregatableWord(counts, func(w wordfreq.Word) error {
+		candidates.Add(wordfreq.Keyword{Word: w.Word, Count: w.Count, Score: float64(w.Count)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	batch := wordfreq.Words{}
+	scoreBatch := func() error {
+		lookup := make([]string, len(batch))
+		for i, w := range batch {
+			lookup[i] = w.Word
+		}
+		freqs, err := wordfreq.QueryDocumentFrequencies(a.svc, a.tableName, scope, lookup)
+		if err != nil {
+			return fmt.Errorf("unable to get document frequencies, %v", err)
+		}
+		for _, w := range batch {
+			collector.Add(wordfreq.Keyword{
+				Word: w.Word, Count: w.Count, Score: freqs.Score(w.Count, counts.Total, w.Word),
+			})
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for _, c := range candidates.Keywords() {
+		batch = append(batch, wordfreq.Word{Word: c.Word, Count: c.Count})
+		if len(batch) < maxKeywordBatch {
+			continue
+		}
+		if err := scoreBatch(); err != nil {
+			return nil, err
+		}
+	}
+	if len(batch) > 0 {
+		if err := scoreBatch(); err != nil {
+			return nil, err
+		}
+	}
+
+	return collector.Keywords(), nil
+}
+
+// eachAggregatableWord calls fn with each word of the counts which can be
+// aggregated. Words which cannot be used as a range key are omitted.
+func eachAggregatableWord(counts *wordfreq.WordCounts, fn func(wordfreq.Word) error) error {
+	return eachWord(counts, func(w wordfreq.Word) error {
+		if w.Word == "" || len(w.Word) > maxRangeKeyLen {
+			return nil
+		}
+		return fn(w)
+	})
+}
+
+// objectVersionIdentity returns the value identifying the version of the
+// job's object. The S3 version ID is preferred, followed by the ETag of the
+// object's content, and the S3 event sequencer.
+func objectVersionIdentity(job *wordfreq.Job) string {
+	switch {
+	case job.VersionID != "":
+		return "version:" + job.VersionID
+	case job.ETag != "":
+		return "etag:" + job.ETag
+	case job.Sequencer != "":
+		return "sequencer:" + job.Sequencer
+	default:
+		return ""
+	}
+}
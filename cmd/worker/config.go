@@ -1,20 +1,56 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"gopkg.in/yaml.v2"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
-const defaultMessageVisibilityTimeout = 60
+const (
+	defaultMessageVisibilityTimeout = 60
+	// Seconds a receive from the job queue waits for messages to arrive,
+	// up to SQS's maximum of 20.
+	defaultReceiveWait = 5
+	maxReceiveWait     = 20
+	// Number of jobs, and results, buffered between the job queue, the
+	// workers, and the result collector.
+	defaultJobBuffer    = 10
+	defaultResultBuffer = 10
+)
 
 var defaultWorkerCount = runtime.NumCPU()
 
+// Sources configuration values are read from, in order of increasing
+// precedence.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// redacted replaces the value of secret settings when the configuration is
+// printed.
+const redacted = "<redacted>"
+
 // A Config provides a collection of configuration values the service will use
 // to setup its components.
 type Config struct {
@@ -26,32 +62,310 @@ type Config struct {
 	ResultQueueURL string
 	// DynamoDB tablename results will be recorded to
 	ResultTableName string
+	// DynamoDB tablename every job attempt will be recorded to. If not set
+	// the history is not recorded.
+	HistoryTableName string
+	// SQS queue URL prefixes a job's results can be sent to, instead of the
+	// result queue. If not set the reply queues of the result queue's account
+	// are allowed.
+	ReplyToPrefixes []string
 	// Number of workers in the worker pool
 	NumWorkers int
 	// The amount of time in seconds a read job message from the SQS will be
 	// hidden from other readers of the queue.
 	MessageVisibilityTimeout int64
+	// The amount of time in seconds a receive from the job queue waits for
+	// messages to arrive.
+	ReceiveWait int64
+	// Number of jobs, and job results, buffered between the components.
+	JobBuffer    int
+	ResultBuffer int
+	// S3 event types the worker will process, other events are ignored.
+	EventTypes EventTypes
+
+	// S3 bucket and key prefix full word histograms will be written to. If
+	// the bucket is not set histograms will not be written.
+	HistogramBucket string
+	HistogramPrefix string
+	// Format histograms will be written in, "json" or "csv".
+	HistogramFormat string
+
+	// DynamoDB tablename corpus wide aggregate word counts will be added to.
+	// If not set aggregate counts will not be recorded.
+	AggregateTableName string
+
+	// Approximate number of bytes each job's word counts may use before they
+	// are spilled to disk. Zero for no limit.
+	MemoryBudget int64
+	// Directory spilled word counts are written to. The system's temporary
+	// directory if not set.
+	SpillDir string
+
+	// Options jobs are counted with, if the job does not set them.
+	Options wordfreq.AnalysisOptions
+
+	// AWS region, and static credentials the worker makes requests with. If
+	// not set, the SDK's default region, and credential chain are used.
+	Region                                     string
+	AccessKeyID, SecretAccessKey, SessionToken string
+
+	// Level of messages logged, "debug", "info", or "error".
+	LogLevel string
+
+	// Print the effective configuration and exit, instead of running.
+	PrintConfig bool
+
+	// Value, and source of each setting the configuration was loaded from.
+	values map[string]configValue
+	// Values set by the config file, including values overridden by
+	// environment variables or flags.
+	fileValues map[string]string
+}
+
+// A configValue is the value of a setting, and the source it was read from.
+type configValue struct {
+	value, source string
+}
+
+// A setting is a configuration value which can be set by the config file, an
+// environment variable, or a command line flag. The setting's name is its
+// key in the config file, and its flag is the name with dashes. Secrets have
+// no flag, since command lines are visible to other users of the host.
+type setting struct {
+	name, env, flag, usage string
+	// Value used if the setting is not set by any source.
+	def func() string
+	// Secret values are redacted when the configuration is printed.
+	secret bool
+	// Parses the value, and sets it on the config, or returns an error
+	// describing the valid values.
+	set func(c *Config, value string) error
+}
+
+// settings are all of the worker's configuration settings.
+var settings = []setting{
+	{name: "queue_url", env: "WORKER_QUEUE_URL", flag: "queue-url",
+		usage: "SQS queue URL job messages are read from",
+		set:   func(c *Config, v string) error { c.WorkerQueueURL = v; return nil }},
+	{name: "result_queue_url", env: "WORKER_RESULT_QUEUE_URL", flag: "result-queue-url",
+		usage: "SQS queue URL job results are sent to",
+		set:   func(c *Config, v string) error { c.ResultQueueURL = v; return nil }},
+	{name: "result_tablename", env: "WORKER_RESULT_TABLENAME", flag: "result-tablename",
+		usage: "DynamoDB table results are recorded to",
+		set:   func(c *Config, v string) error { c.ResultTableName = v; return nil }},
+	{name: "history_tablename", env: "WORKER_HISTORY_TABLENAME", flag: "history-tablename",
+		usage: "DynamoDB table every job attempt is recorded to",
+		set:   func(c *Config, v string) error { c.HistoryTableName = v; return nil }},
+	{name: "reply_to_prefixes", env: "WORKER_REPLY_TO_PREFIXES", flag: "reply-to-prefixes",
+		usage: "comma separated SQS queue URL prefixes job results can be sent to instead of the result queue, the result queue account's wordfreq-reply- queues if not set",
+		set: func(c *Config, v string) error {
+			c.ReplyToPrefixes = nil
+			for _, prefix := range strings.Split(v, ",") {
+				if prefix = strings.TrimSpace(prefix); prefix != "" {
+					c.ReplyToPrefixes = append(c.ReplyToPrefixes, prefix)
+				}
+			}
+			return nil
+		}},
+	{name: "message_visibility", env: "WORKER_MESSAGE_VISIBILITY", flag: "message-visibility",
+		usage: "seconds job messages are hidden from other readers of the queue",
+		def:   constant(strconv.Itoa(defaultMessageVisibilityTimeout)),
+		set: func(c *Config, v string) (err error) {
+			c.MessageVisibilityTimeout, err = parseInt(v, 1, -1)
+			return err
+		}},
+	{name: "receive_wait", env: "WORKER_RECEIVE_WAIT", flag: "receive-wait",
+		usage: "seconds a receive from the job queue waits for messages",
+		def:   constant(strconv.Itoa(defaultReceiveWait)),
+		set: func(c *Config, v string) (err error) {
+			c.ReceiveWait, err = parseInt(v, 0, maxReceiveWait)
+			return err
+		}},
+	{name: "worker_count", env: "WORKER_COUNT", flag: "worker-count",
+		usage: "number of workers in the worker pool",
+		def:   func() string { return strconv.Itoa(defaultWorkerCount) },
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, 1, -1)
+			c.NumWorkers = int(n)
+			return err
+		}},
+	{name: "job_buffer", env: "WORKER_JOB_BUFFER", flag: "job-buffer",
+		usage: "number of jobs buffered between the job queue and the workers",
+		def:   constant(strconv.Itoa(defaultJobBuffer)),
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, 0, -1)
+			c.JobBuffer = int(n)
+			return err
+		}},
+	{name: "result_buffer", env: "WORKER_RESULT_BUFFER", flag: "result-buffer",
+		usage: "number of results buffered between the workers and the result collector",
+		def:   constant(strconv.Itoa(defaultResultBuffer)),
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, 0, -1)
+			c.ResultBuffer = int(n)
+			return err
+		}},
+	{name: "event_types", env: "WORKER_EVENT_TYPES", flag: "event-types",
+		usage: "comma separated S3 event types processed",
+		def:   constant(strings.Join(defaultEventTypes, ",")),
+		set: func(c *Config, v string) error {
+			c.EventTypes = nil
+			for _, eventType := range strings.Split(v, ",") {
+				if eventType = strings.TrimSpace(eventType); eventType != "" {
+					c.EventTypes = append(c.EventTypes, eventType)
+				}
+			}
+			if len(c.EventTypes) == 0 {
+				return fmt.Errorf("must have at least one event type")
+			}
+			return nil
+		}},
+	{name: "histogram_bucket", env: "WORKER_HISTOGRAM_BUCKET", flag: "histogram-bucket",
+		usage: "S3 bucket full word histograms are written to",
+		set:   func(c *Config, v string) error { c.HistogramBucket = v; return nil }},
+	{name: "histogram_prefix", env: "WORKER_HISTOGRAM_PREFIX", flag: "histogram-prefix",
+		usage: "key prefix histograms are written under",
+		set:   func(c *Config, v string) error { c.HistogramPrefix = v; return nil }},
+	{name: "histogram_format", env: "WORKER_HISTOGRAM_FORMAT", flag: "histogram-format",
+		usage: "format histograms are written in, json or csv",
+		def:   constant(histogramFormatJSON),
+		set: func(c *Config, v string) error {
+			if v != histogramFormatJSON && v != histogramFormatCSV {
+				return fmt.Errorf("must be %s or %s", histogramFormatJSON, histogramFormatCSV)
+			}
+			c.HistogramFormat = v
+			return nil
+		}},
+	{name: "aggregate_tablename", env: "WORKER_AGGREGATE_TABLENAME", flag: "aggregate-tablename",
+		usage: "DynamoDB table aggregate word counts are added to",
+		set:   func(c *Config, v string) error { c.AggregateTableName = v; return nil }},
+	{name: "memory_budget", env: "WORKER_MEMORY_BUDGET", flag: "memory-budget",
+		usage: "approximate bytes of each job's word counts held in memory before spilling to disk, 0 for no limit",
+		def:   constant("0"),
+		set: func(c *Config, v string) (err error) {
+			c.MemoryBudget, err = parseInt(v, 0, -1)
+			return err
+		}},
+	{name: "spill_dir", env: "WORKER_SPILL_DIR", flag: "spill-dir",
+		usage: "directory word counts are spilled to",
+		set:   func(c *Config, v string) error { c.SpillDir = v; return nil }},
+	{name: "top", env: "WORKER_TOP", flag: "top",
+		usage: "number of most common words collected for jobs which do not set it",
+		def:   constant(strconv.Itoa(wordfreq.DefaultTop)),
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, 1, -1)
+			c.Options.Top = int(n)
+			return err
+		}},
+	{name: "min_word_length", env: "WORKER_MIN_WORD_LENGTH", flag: "min-word-length",
+		usage: "minimum length of words counted for jobs which do not set it",
+		def:   constant(strconv.Itoa(wordfreq.DefaultMinWordLength)),
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, 1, -1)
+			c.Options.MinWordLength = int(n)
+			return err
+		}},
+	{name: "max_word_length", env: "WORKER_MAX_WORD_LENGTH", flag: "max-word-length",
+		usage: "maximum length in bytes of words counted for jobs which do not set it",
+		def:   constant(strconv.Itoa(wordfreq.DefaultMaxWordLength)),
+		set: func(c *Config, v string) error {
+			n, err := parseInt(v, utf8.UTFMax, -1)
+			c.Options.MaxWordLength = int(n)
+			return err
+		}},
+	{name: "long_word_policy", env: "WORKER_LONG_WORD_POLICY", flag: "long-word-policy",
+		usage: "policy for words longer than the maximum length, skip or truncate, for jobs which do not set it",
+		def:   constant(wordfreq.LongWordSkip),
+		set: func(c *Config, v string) error {
+			if v != wordfreq.LongWordSkip && v != wordfreq.LongWordTruncate {
+				return fmt.Errorf("must be %s or %s", wordfreq.LongWordSkip, wordfreq.LongWordTruncate)
+			}
+			c.Options.LongWordPolicy = v
+			return nil
+		}},
+	{name: "log_level", env: "WORKER_LOG_LEVEL", flag: "log-level",
+		usage: "level of messages logged, debug, info, or error",
+		def:   constant(logLevelInfo),
+		set: func(c *Config, v string) error {
+			if _, ok := logLevels[v]; !ok {
+				return fmt.Errorf("must be %s, %s, or %s", logLevelDebug, logLevelInfo, logLevelError)
+			}
+			c.LogLevel = v
+			return nil
+		}},
+	{name: "region", env: "AWS_REGION", flag: "region",
+		usage: "AWS region requests are made to, retrieved from the EC2 instance if not set",
+		set:   func(c *Config, v string) error { c.Region = v; return nil }},
+	{name: "access_key_id", env: "AWS_ACCESS_KEY_ID", flag: "access-key-id",
+		usage: "AWS access key ID, the SDK's default credentials are used if not set",
+		set:   func(c *Config, v string) error { c.AccessKeyID = v; return nil }},
+	{name: "secret_access_key", env: "AWS_SECRET_ACCESS_KEY",
+		usage: "AWS secret access key", secret: true,
+		set: func(c *Config, v string) error { c.SecretAccessKey = v; return nil }},
+	{name: "session_token", env: "AWS_SESSION_TOKEN",
+		usage: "AWS session token of temporary credentials", secret: true,
+		set: func(c *Config, v string) error { c.SessionToken = v; return nil }},
+}
+
+// requiredSettings are the names of the settings which must be set.
+var requiredSettings = []string{"queue_url", "result_queue_url", "result_tablename"}
+
+// isRequired returns if the setting must be set.
+func isRequired(name string) bool {
+	for _, required := range requiredSettings {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+// constant returns a setting default function of the value.
+func constant(value string) func() string {
+	return func() string { return value }
+}
+
+// parseInt parses the value as an integer, which must be at least min, and if
+// max is not negative, no more than max.
+func parseInt(value string, min, max int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < min || (max >= 0 && n > max) {
+		if max >= 0 {
+			return 0, fmt.Errorf("must be an integer from %d to %d", min, max)
+		}
+		return 0, fmt.Errorf("must be an integer of at least %d", min)
+	}
+	return n, nil
 }
 
-// getConfig collects the configuration from the environment variables, and
-// returns it, or error if it was unable to collect the configuration.
-func getConfig() (Config, error) {
-	c := Config{
-		WorkerQueueURL:  os.Getenv("WORKER_QUEUE_URL"),
-		ResultQueueURL:  os.Getenv("WORKER_RESULT_QUEUE_URL"),
-		ResultTableName: os.Getenv("WORKER_RESULT_TABLENAME"),
-		Session:         session.New(),
+// getConfig collects the configuration from the config file, environment
+// variables, and command line arguments, and returns it, or error if it was
+// unable to collect the configuration. Flags take precedence over environment
+// variables, which take precedence over the config file, then the defaults.
+//
+// The config file is set by the -config flag, or the WORKER_CONFIG_FILE
+// environment variable. Files with the .json extension are JSON, otherwise
+// the file is YAML.
+func getConfig(args []string) (Config, error) {
+	c, err := loadConfig(args)
+	if err != nil {
+		return c, err
 	}
 
-	if c.WorkerQueueURL == "" {
-		return c, fmt.Errorf("missing WORKER_QUEUE_URL")
+	// The configuration is only printed, so there is no need to connect
+	// to AWS.
+	if c.PrintConfig {
+		return c, nil
 	}
-	if c.ResultQueueURL == "" {
-		return c, fmt.Errorf("missing WORKER_RESULT_QUEUE_URL")
+
+	awsCfg := &aws.Config{}
+	if c.Region != "" {
+		awsCfg.Region = aws.String(c.Region)
 	}
-	if c.ResultTableName == "" {
-		return c, fmt.Errorf("missing WORKER_RESULT_TABLENAME")
+	if c.AccessKeyID != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
 	}
+	c.Session = session.New(awsCfg)
 
 	if aws.StringValue(c.Session.Config.Region) == "" {
 		region, err := ec2metadata.New(c.Session).Region()
@@ -61,32 +375,206 @@ func getConfig() (Config, error) {
 		c.Session.Config.Region = aws.String(region)
 	}
 
-	if timeoutStr := os.Getenv("WORKER_MESSAGE_VISIBILITY"); timeoutStr != "" {
-		timeout, err := strconv.ParseInt(timeoutStr, 10, 64)
-		if err != nil {
-			return c, err
+	return c, nil
+}
+
+// loadConfig loads and validates the configuration from the config file,
+// environment variables, and command line arguments, without creating the
+// AWS session. Used by getConfig, and to reload the configuration while the
+// worker is running. Required settings are not validated if the configuration
+// is only printed.
+func loadConfig(args []string) (Config, error) {
+	c := Config{values: map[string]configValue{}, fileValues: map[string]string{}}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("WORKER_CONFIG_FILE"),
+		"YAML or JSON config file, env WORKER_CONFIG_FILE")
+	fs.BoolVar(&c.PrintConfig, "print-config", false,
+		"print the effective configuration, with secrets redacted, and exit")
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
 		}
-		if timeout <= 0 {
-			return c, fmt.Errorf("invalid message visibility timeout")
+		usage := fmt.Sprintf("%s, env %s", s.usage, s.env)
+		if s.def != nil {
+			usage += fmt.Sprintf(" (default %s)", s.def())
 		}
-		c.MessageVisibilityTimeout = timeout
-	} else {
-		c.MessageVisibilityTimeout = defaultMessageVisibilityTimeout
+		fs.String(s.flag, "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected arguments %v", fs.Args())
 	}
 
-	atOnceStr := os.Getenv("WORKER_COUNT")
-	if atOnceStr == "" {
-		c.NumWorkers = defaultWorkerCount
-	} else {
-		atOnce, err := strconv.ParseInt(atOnceStr, 10, 64)
+	for _, s := range settings {
+		if s.def != nil {
+			c.values[s.name] = configValue{value: s.def(), source: sourceDefault}
+		}
+	}
+	if *configFile != "" {
+		fileValues, err := readConfigFile(*configFile)
 		if err != nil {
-			return c, err
+			return c, fmt.Errorf("unable to read config file %s, %v", *configFile, err)
 		}
-		if atOnce <= 0 {
-			return c, fmt.Errorf("invalid worker number")
+		for name, value := range fileValues {
+			c.values[name] = configValue{value: value, source: sourceFile + " " + *configFile}
 		}
-		c.NumWorkers = int(atOnce)
+		c.fileValues = fileValues
+	}
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			c.values[s.name] = configValue{value: value, source: sourceEnv + " " + s.env}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				c.values[s.name] = configValue{value: f.Value.String(), source: sourceFlag + " -" + s.flag}
+			}
+		}
+	})
+
+	for _, s := range settings {
+		v, ok := c.values[s.name]
+		if !ok {
+			continue
+		}
+		if err := s.set(&c, v.value); err != nil {
+			value := strconv.Quote(v.value)
+			if s.secret {
+				value = redacted
+			}
+			return c, fmt.Errorf("invalid %s %s from %s, %v", s.name, value, v.source, err)
+		}
+	}
+	// The configuration is printed even if it is incomplete, so the missing
+	// settings can be seen.
+	if c.PrintConfig {
+		return c, nil
+	}
+	for _, name := range requiredSettings {
+		if _, ok := c.values[name]; !ok {
+			s := findSetting(name)
+			return c, fmt.Errorf("missing %s, set by the -%s flag, %s environment variable, or config file",
+				name, s.flag, s.env)
+		}
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return c, fmt.Errorf("access_key_id and secret_access_key must be set together")
+	}
+	if c.Options.MaxWordLength < c.Options.MinWordLength {
+		return c, fmt.Errorf("max_word_length %d less than min_word_length %d",
+			c.Options.MaxWordLength, c.Options.MinWordLength)
 	}
 
 	return c, nil
 }
+
+// findSetting returns the setting with the name.
+func findSetting(name string) setting {
+	for _, s := range settings {
+		if s.name == name {
+			return s
+		}
+	}
+	panic("unknown setting " + name)
+}
+
+// readConfigFile reads the setting values of the config file. Lists of
+// values, such as event types, are joined with commas. Returns an error if
+// the file sets any unknown settings.
+func readConfigFile(filename string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		// Numbers are decoded as written, large integers such as the
+		// memory budget would lose precision as floats.
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil && err != io.EOF {
+			return nil, err
+		}
+	} else if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for name, v := range raw {
+		found := false
+		for _, s := range settings {
+			found = found || s.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown setting %s", name)
+		}
+
+		switch v := v.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			parts := make([]string, 0, len(v))
+			for _, part := range v {
+				parts = append(parts, configValueString(part))
+			}
+			values[name] = strings.Join(parts, ",")
+		case map[string]interface{}, map[interface{}]interface{}:
+			return nil, fmt.Errorf("invalid %s, must not be a map", name)
+		default:
+			values[name] = configValueString(v)
+		}
+	}
+	return values, nil
+}
+
+// configValueString returns the string of a config file value. Whole numbers
+// are formatted as integers, since YAML decodes numbers such as 1e9 as floats,
+// which would otherwise be formatted with an exponent.
+func configValueString(v interface{}) string {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case json.Number:
+		var err error
+		if _, err = n.Int64(); err == nil {
+			return n.String()
+		}
+		if f, err = n.Float64(); err != nil {
+			return n.String()
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// Print writes the effective configuration to the writer as YAML, which can
+// be used as a config file. Each setting is commented with the source its
+// value was read from, and secret values are redacted.
+func (c Config) Print(w io.Writer) {
+	for _, s := range settings {
+		v, ok := c.values[s.name]
+		if !ok {
+			if isRequired(s.name) {
+				fmt.Fprintf(w, "# %s: not set, required\n", s.name)
+			} else {
+				fmt.Fprintf(w, "# %s: not set\n", s.name)
+			}
+			continue
+		}
+		value := strconv.Quote(v.value)
+		if s.secret {
+			value = redacted
+		}
+		fmt.Fprintf(w, "%s: %s # %s\n", s.name, value, v.source)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// Histogram formats supported by the HistogramWriter.
+const (
+	histogramFormatJSON = "json"
+	histogramFormatCSV  = "csv"
+)
+
+// A HistogramWriter provides writing the full histogram of words counted for
+// a job to S3. Since a job's full vocabulary could exceed the DynamoDB item
+// size limit, only the location of the histogram is recorded with the result.
+type HistogramWriter struct {
+	bucket, prefix, format string
+	tempDir                string
+	uploader               *s3manager.Uploader
+}
+
+// NewHistogramWriter creates a new instance of the HistogramWriter which will
+// write histograms in the format provided to the bucket and key prefix. The
+// histograms are written to temporary files in the temp directory before they
+// are uploaded, the system's temporary directory if empty.
+func NewHistogramWriter(bucket, prefix, format, tempDir string, uploader *s3manager.Uploader) *HistogramWriter {
+	return &HistogramWriter{
+		bucket:   bucket,
+		prefix:   prefix,
+		format:   format,
+		tempDir:  tempDir,
+		uploader: uploader,
+	}
+}
+
+// Write encodes, and gzip compresses the histogram of words counted for the
+// job, and uploads it to S3. The histogram's object key is the job's bucket
+// and key under the writer's prefix, followed by the version of the job's
+// object. Returns the location of the histogram.
+//
+// Histograms are written before the job's result is recorded, which is not
+// recorded if a newer result already was. Since each version of an object has
+// its own histogram, the histogram of an older version never replaces the
+// histogram a recorded result refers to.
+//
+// The histogram is written to a temporary file before it is uploaded, so
+// histograms of counts spilled to disk do not need to be held in memory.
+// Words are sorted by word, whether or not the counts were spilled.
+func (h *HistogramWriter) Write(job *wordfreq.Job, counts *wordfreq.WordCounts) (*wordfreq.HistogramLocation, error) {
+	f, err := ioutil.TempFile(h.tempDir, "wordfreq-histogram-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, hash))
+	if err := h.encode(gz, counts); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	location := &wordfreq.HistogramLocation{
+		Bucket:   h.bucket,
+		Key:      histogramKey(h.prefix, job) + "." + h.format + ".gz",
+		Format:   h.format,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	_, err = h.uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(location.Bucket),
+		Key:         aws.String(location.Key),
+		Body:        f,
+		ContentType: aws.String("application/gzip"),
+		Metadata: map[string]*string{
+			"sha256": aws.String(location.Checksum),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// encode writes the words to the writer in the histogram's format. The JSON
+// format is an array of words, written one word at a time.
+func (h *HistogramWriter) encode(w io.Writer, counts *wordfreq.WordCounts) error {
+	switch h.format {
+	case histogramFormatCSV:
+		csvW := csv.NewWriter(w)
+		csvW.Write([]string{"word", "count"})
+		err := eachWord(counts, func(word wordfreq.Word) error {
+			return csvW.Write([]string{word.Word, strconv.Itoa(word.Count)})
+		})
+		if err != nil {
+			return err
+		}
+		csvW.Flush()
+		return csvW.Error()
+	case histogramFormatJSON:
+		bw := bufio.NewWriter(w)
+		bw.WriteByte('[')
+		first := true
+		err := eachWord(counts, func(word wordfreq.Word) error {
+			b, err := json.Marshal(word)
+			if err != nil {
+				return err
+			}
+			if !first {
+				bw.WriteByte(',')
+			}
+			first = false
+			_, err = bw.Write(b)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		bw.WriteString("]\n")
+		return bw.Flush()
+	default:
+		return fmt.Errorf("unknown histogram format %s", h.format)
+	}
+}
+
+// eachWord calls fn with each word counted, sorted by word. The order is the
+// same whether or not the counts were spilled, so histograms and aggregate
+// chunks are the same each time the same counts are processed.
+func eachWord(counts *wordfreq.WordCounts, fn func(wordfreq.Word) error) error {
+	return counts.Each(func(word string, count int) error {
+		return fn(wordfreq.Word{Word: word, Count: count})
+	})
+}
+
+// histogramKey returns the key, without extension, of the histogram of the
+// job's object version. The object's key is not cleaned, since keys such as
+// a//b and a/./b are distinct objects whose histograms must not collide.
+func histogramKey(prefix string, job *wordfreq.Job) string {
+	key := job.Bucket + "/" + job.Key
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	if identity := objectVersionIdentity(job); identity != "" {
+		key += "." + strings.Replace(identity, ":", "-", 1)
+	}
+	return key
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// unwrapS3EventMsg unmarshals the SQS message body into a S3 event message.
+// In addition to S3 notifications sent directly to the SQS queue, the body may
+// be a SNS notification wrapping the S3 notification, or an EventBridge S3
+// event. The format of the body is detected from the fields it contains.
+func unwrapS3EventMsg(body string) (s3EventMsg, error) {
+	envelope := messageEnvelope{}
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return s3EventMsg{}, fmt.Errorf("parse job message %v", err)
+	}
+
+	switch {
+	case envelope.Type == "Notification" && envelope.Message != "":
+		// SNS delivers the S3 notification as a JSON string in its Message.
+		return unwrapS3EventMsg(envelope.Message)
+
+	case envelope.Source == "aws.s3" && envelope.DetailType != "":
+		return eventBridgeToS3EventMsg(envelope)
+	}
+
+	s3msg := s3EventMsg{}
+	if err := json.Unmarshal([]byte(body), &s3msg); err != nil {
+		return s3msg, fmt.Errorf("parse Amazon S3 Event message %v", err)
+	}
+	return s3msg, nil
+}
+
+// eventBridgeToS3EventMsg converts the EventBridge S3 event into the S3 event
+// message form, with a single record. EventBridge detail types and reasons are
+// mapped to their equivalent S3 notification event names.
+func eventBridgeToS3EventMsg(envelope messageEnvelope) (s3EventMsg, error) {
+	detail := eventBridgeS3Detail{}
+	if err := json.Unmarshal(envelope.Detail, &detail); err != nil {
+		return s3EventMsg{}, fmt.Errorf("parse EventBridge S3 event detail %v", err)
+	}
+
+	record := s3EventRecord{Region: envelope.Region}
+	switch envelope.DetailType {
+	case "Object Created":
+		switch detail.Reason {
+		case "PutObject":
+			record.EventName = "ObjectCreated:Put"
+		case "POST Object":
+			record.EventName = "ObjectCreated:Post"
+		case "CopyObject":
+			record.EventName = "ObjectCreated:Copy"
+		default:
+			record.EventName = "ObjectCreated:" + detail.Reason
+		}
+	case "Object Deleted":
+		if detail.DeletionType == "Delete Marker Created" {
+			record.EventName = "ObjectRemoved:DeleteMarkerCreated"
+		} else {
+			record.EventName = "ObjectRemoved:Delete"
+		}
+	default:
+		// Other EventBridge S3 events are not acted on, and will be ignored
+		// by the event type filter.
+		record.EventName = envelope.DetailType
+	}
+
+	record.S3.Bucket.Name = detail.Bucket.Name
+	record.S3.Object.Key = detail.Object.Key
+	record.S3.Object.ETag = detail.Object.ETag
+	record.S3.Object.VersionID = detail.Object.VersionID
+	record.S3.Object.Sequencer = detail.Object.Sequencer
+
+	return s3EventMsg{Records: []s3EventRecord{record}}, nil
+}
+
+// A messageEnvelope represents the fields of the SNS notification and the
+// EventBridge event used to detect which format a job message is in.
+type messageEnvelope struct {
+	// SNS notification fields
+	Type    string
+	Message string
+
+	// EventBridge event fields
+	Source     string          `json:"source"`
+	DetailType string          `json:"detail-type"`
+	Region     string          `json:"region"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// A eventBridgeS3Detail represents the detail of an EventBridge S3 event. This
+// is an abbreviated form of the detail since not all fields are used by this
+// service.
+type eventBridgeS3Detail struct {
+	Bucket struct {
+		Name string `json:"name"`
+	} `json:"bucket"`
+	Object struct {
+		Key       string `json:"key"`
+		ETag      string `json:"etag"`
+		VersionID string `json:"version-id"`
+		Sequencer string `json:"sequencer"`
+	} `json:"object"`
+	Reason       string `json:"reason"`
+	DeletionType string `json:"deletion-type"`
+}
@@ -3,39 +3,218 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
+// s3TestEvent is the event S3 sends to a queue when the bucket's notification
+// configuration is first set up.
+const s3TestEvent = "s3:TestEvent"
+
 // parseJobMessage unmarshals the JSON job message, and constructs a worker job
 // from it. Since S3 messages can include multiple records each individual job
 // is added to the job channel so a worker from the worker pool can read it,
-// and process the job.
-func parseJobMessage(jobCh chan<- *wordfreq.Job, msg wordfreq.JobMessage, timeout int64) error {
-	fmt.Println("Procesing message", msg.ID)
+// and process the job. Records with event types not selected by the event
+// types are ignored. The number of jobs added to the job channel is returned.
+func parseJobMessage(jobCh chan<- *wordfreq.Job, msg wordfreq.JobMessage, timeout int64, events EventTypes) (int, error) {
+	debugLog.Println("Procesing message", msg.ID)
+
+	// Job requests sent directly to the job queue describe a single job.
+	if job, ok, err := parseJobRequest(msg, timeout); err != nil {
+		return 0, err
+	} else if ok {
+		jobCh <- job
+		return 1, nil
+	}
 
-	s3msg := s3EventMsg{}
-	if err := json.Unmarshal([]byte(msg.Body), &s3msg); err != nil {
-		return fmt.Errorf("parse Amazon S3 Event message %v", err)
+	s3msg, err := unwrapS3EventMsg(msg.Body)
+	if err != nil {
+		return 0, err
 	}
 
+	if s3msg.Event == s3TestEvent {
+		return 0, nil
+	}
 	if len(s3msg.Records) == 0 {
-		return fmt.Errorf("job does not have any records")
+		return 0, fmt.Errorf("job does not have any records")
 	}
 
+	// All records are parsed before any job is added to the job channel, so
+	// that a message which fails to parse has no jobs already in progress.
+	jobs := []*wordfreq.Job{}
 	for _, record := range s3msg.Records {
-		jobCh <- &wordfreq.Job{
-			StartedAt:         time.Now(),
+		action, ok := events.Action(record.EventName)
+		if !ok {
+			debugLog.Println("Ignoring", record.EventName, "event record in message", msg.ID)
+			continue
+		}
+
+		// S3 event object keys are URL encoded, with spaces encoded as "+".
+		// The key needs to be decoded before it can be used to get the object.
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return 0, fmt.Errorf("decode object key %q, %v", record.S3.Object.Key, err)
+		}
+
+		jobs = append(jobs, &wordfreq.Job{
+			ReceivedAt:        time.Now(),
 			VisibilityTimeout: timeout,
 			OrigMessage:       msg,
+			Action:            action,
 			Region:            record.Region,
 			Bucket:            record.S3.Bucket.Name,
-			Key:               record.S3.Object.Key,
+			Key:               key,
+			ETag:              record.S3.Object.ETag,
+			VersionID:         record.S3.Object.VersionID,
+			Sequencer:         normalizeSequencer(record.S3.Object.Sequencer),
+		})
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+
+	return len(jobs), nil
+}
+
+// EventTypes is a list of S3 event type patterns the worker will act on, e.g.
+// "ObjectCreated:*" or "ObjectRemoved:Delete". A pattern ending in "*" matches
+// all event types with the same prefix.
+type EventTypes []string
+
+// defaultEventTypes are the S3 event types acted on if none are configured.
+var defaultEventTypes = EventTypes{"ObjectCreated:*", "ObjectRemoved:*"}
+
+// Action returns the job action for the S3 event name, and if the event
+// should be acted on. ObjectCreated events count the object's words, and
+// ObjectRemoved events remove the object's result.
+func (e EventTypes) Action(eventName string) (wordfreq.JobAction, bool) {
+	eventName = strings.TrimPrefix(eventName, "s3:")
+
+	matched := false
+	for _, pattern := range e {
+		pattern = strings.TrimPrefix(pattern, "s3:")
+		if strings.HasSuffix(pattern, "*") {
+			matched = strings.HasPrefix(eventName, strings.TrimSuffix(pattern, "*"))
+		} else {
+			matched = eventName == pattern
+		}
+		if matched {
+			break
 		}
 	}
+	if !matched {
+		return "", false
+	}
 
-	return nil
+	switch {
+	case strings.HasPrefix(eventName, "ObjectCreated:"):
+		return wordfreq.JobActionCount, true
+	case strings.HasPrefix(eventName, "ObjectRemoved:"):
+		return wordfreq.JobActionRemove, true
+	default:
+		return "", false
+	}
+}
+
+// parseJobRequest unmarshals the job message as a wordfreq.JobRequest if the
+// message has a JobVersion field, and constructs a worker job from it. False
+// is returned if the message is not a job request. If the job request is
+// invalid, including fields of the wrong type, a jobRejectedError is returned
+// with the job so its failure can be reported to the caller.
+func parseJobRequest(msg wordfreq.JobMessage, timeout int64) (*wordfreq.Job, bool, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(msg.Body), &fields); err != nil {
+		// Messages which are not JSON objects are parsed as S3 events.
+		return nil, false, nil
+	}
+	if _, ok := fields["JobVersion"]; !ok {
+		return nil, false, nil
+	}
+
+	req := wordfreq.JobRequest{}
+	decodeErr := json.Unmarshal([]byte(msg.Body), &req)
+	if decodeErr != nil {
+		// Fields of the wrong type stop unmarshaling, so the fields
+		// identifying the job and its caller are decoded individually for
+		// the rejected result.
+		req = wordfreq.JobRequest{
+			Region:        rawString(fields, "Region"),
+			Bucket:        rawString(fields, "Bucket"),
+			Key:           rawString(fields, "Key"),
+			CorrelationID: rawString(fields, "CorrelationID"),
+			ReplyTo:       rawString(fields, "ReplyTo"),
+		}
+	}
+
+	job := &wordfreq.Job{
+		ReceivedAt:        time.Now(),
+		VisibilityTimeout: timeout,
+		OrigMessage:       msg,
+		Action:            wordfreq.JobActionCount,
+		Region:            req.Region,
+		Bucket:            req.Bucket,
+		Key:               req.Key,
+		Options:           req.Options,
+		CorrelationID:     req.CorrelationID,
+		ReplyTo:           req.ReplyTo,
+	}
+	err := decodeErr
+	if err != nil {
+		err = fmt.Errorf("invalid job request, %v", err)
+	} else {
+		err = req.Validate()
+	}
+	if err != nil {
+		// Rejected jobs are never processed by a worker.
+		job.StartedAt = job.ReceivedAt
+		return nil, true, &jobRejectedError{
+			Job: job, Err: wordfreq.NewJobError(wordfreq.ErrInvalidJob, err),
+		}
+	}
+
+	return job, true, nil
+}
+
+// rawString returns the field's value if it is a JSON string, otherwise an
+// empty string.
+func rawString(fields map[string]json.RawMessage, name string) string {
+	var v string
+	if err := json.Unmarshal(fields[name], &v); err != nil {
+		return ""
+	}
+	return v
+}
+
+// A jobRejectedError is returned when a job message was parsed, but the job it
+// describes cannot be processed. Instead of only deleting the message, the
+// failed result of the job should be reported to the caller.
+type jobRejectedError struct {
+	Job *wordfreq.Job
+	Err *wordfreq.JobError
+}
+
+// Error returns the string representation of the error.
+func (e *jobRejectedError) Error() string {
+	return fmt.Sprintf("job rejected, %v", e.Err)
+}
+
+// sequencerLen is the length S3 event sequencers are padded to so that they
+// can be compared as strings.
+const sequencerLen = 32
+
+// normalizeSequencer left pads the S3 event sequencer with zeros. S3 only
+// guarantees sequencers for the same key can be compared after being padded to
+// the same length. Padding them at parse time allows the sequencers to be
+// compared directly, including by DynamoDB condition expressions.
+func normalizeSequencer(sequencer string) string {
+	if sequencer == "" || len(sequencer) >= sequencerLen {
+		return strings.ToUpper(sequencer)
+	}
+	return strings.Repeat("0", sequencerLen-len(sequencer)) + strings.ToUpper(sequencer)
 }
 
 // A s3EventMsg represents the SQS message provided by S3 Notifications. This
@@ -43,16 +222,22 @@ func parseJobMessage(jobCh chan<- *wordfreq.Job, msg wordfreq.JobMessage, timeou
 // service.
 type s3EventMsg struct {
 	Event   string
-	Records []struct {
-		Region    string `json:"awsRegion"`
-		EventName string
-		S3        struct {
-			Bucket struct {
-				Name string
-			}
-			Object struct {
-				Key string
-			}
+	Records []s3EventRecord
+}
+
+// A s3EventRecord represents a single S3 event within the S3 notification.
+type s3EventRecord struct {
+	Region    string `json:"awsRegion"`
+	EventName string
+	S3        struct {
+		Bucket struct {
+			Name string
+		}
+		Object struct {
+			Key       string
+			ETag      string `json:"eTag"`
+			VersionID string `json:"versionId"`
+			Sequencer string `json:"sequencer"`
 		}
 	}
 }
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,27 +12,46 @@ import (
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
+const (
+	// The base delay in seconds a message will be hidden for before a job
+	// which failed with a transient error is retried. Doubled for each
+	// time the message has been received.
+	retryBaseDelay = 5
+	// The max delay in seconds a message will be hidden for before a job
+	// is retried.
+	retryMaxDelay = 15 * 60
+)
+
 // A JobMessageQueue provides listening to a SQS queue for job messages, and
 // providing those job messages as a job channel to workers so the jobs can be
 // processed.
 type JobMessageQueue struct {
-	queueURL        string
+	queueURL string
+	// Visibility timeout, and receive wait time in seconds. Accessed
+	// atomically, so they can be changed while the queue is listening.
 	queueVisibility int64
 	queueWait       int64
+	events          EventTypes
 
-	jobCh  chan *wordfreq.Job
-	msgSvc sqsiface.SQSAPI
+	jobCh    chan *wordfreq.Job
+	resultCh chan<- *wordfreq.JobResult
+	msgSvc   sqsiface.SQSAPI
 }
 
 // NewJobMessageQueue creates a new instance of the JobMessageQueue configuring it
 // for the SQS service client it will use. The sqsiface.SQSAPI is used so that
-// the code could be unit tested in isolating without also testing the SDK.
-func NewJobMessageQueue(url string, visibilityTime, waitTime int64, svc sqsiface.SQSAPI) *JobMessageQueue {
+// the code could be unit tested in isolating without also testing the SDK. Only
+// S3 events matching the event types will be processed. Results of jobs which
+// are rejected when parsed will be sent to the result channel. Up to the
+// buffer size jobs are buffered waiting for workers.
+func NewJobMessageQueue(url string, visibilityTime, waitTime int64, bufferSize int, events EventTypes, resultCh chan<- *wordfreq.JobResult, svc sqsiface.SQSAPI) *JobMessageQueue {
 	return &JobMessageQueue{
 		queueURL:        url,
 		queueVisibility: visibilityTime,
 		queueWait:       waitTime,
-		jobCh:           make(chan *wordfreq.Job, 10),
+		events:          events,
+		jobCh:           make(chan *wordfreq.Job, bufferSize),
+		resultCh:        resultCh,
 		msgSvc:          svc,
 	}
 }
@@ -40,9 +59,9 @@ func NewJobMessageQueue(url string, visibilityTime, waitTime int64, svc sqsiface
 // Listen waits for messages to arrive from the SQS queue, parses the JSON
 // message and sends the jobs to the job channel to be processed by the worker pool.
 func (m *JobMessageQueue) Listen(doneCh <-chan struct{}) {
-	fmt.Println("Job Message queue starting")
+	infoLog.Println("Job Message queue starting")
 	defer close(m.jobCh)
-	defer fmt.Println("Job Message queue quitting.")
+	defer infoLog.Println("Job Message queue quitting.")
 
 	for {
 		select {
@@ -51,7 +70,7 @@ func (m *JobMessageQueue) Listen(doneCh <-chan struct{}) {
 		default:
 			msgs, err := m.receiveMsg()
 			if err != nil {
-				log.Println("Failed to read from message queue", err)
+				errorLog.Println("Failed to read from message queue", err)
 				time.Sleep(5 * time.Second)
 				continue
 			}
@@ -62,16 +81,35 @@ func (m *JobMessageQueue) Listen(doneCh <-chan struct{}) {
 			// to bump up the number of messages that will be read from SQS at once
 			// by default only one message is read.
 			for _, msg := range msgs {
-				parseErr := parseJobMessage(m.jobCh,
+				receiveCount, _ := strconv.Atoi(aws.StringValue(
+					msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+				numJobs, parseErr := parseJobMessage(m.jobCh,
 					wordfreq.JobMessage{
 						ID:            *msg.MessageId,
 						ReceiptHandle: *msg.ReceiptHandle,
 						Body:          *msg.Body,
+						ReceiveCount:  receiveCount,
 					},
-					m.queueVisibility,
+					m.visibilityTimeout(),
+					m.events,
 				)
-				if parseErr != nil {
-					fmt.Println("Failed to parse", *msg.MessageId, "job message,", parseErr)
+				if rejectErr, ok := parseErr.(*jobRejectedError); ok {
+					// The result collector will report the rejected job's
+					// failure, and delete its message.
+					infoLog.Println("Rejected", *msg.MessageId, "job message,", rejectErr.Err)
+					m.resultCh <- &wordfreq.JobResult{
+						Job:           rejectErr.Job,
+						Status:        wordfreq.JobCompleteFailure,
+						StatusMessage: rejectErr.Err.Error(),
+						ErrorCode:     rejectErr.Err.Code,
+					}
+				} else if parseErr != nil {
+					errorLog.Println("Failed to parse", *msg.MessageId, "job message,", parseErr)
+					m.DeleteMessage(*msg.ReceiptHandle)
+				} else if numJobs == 0 {
+					// Test events, and messages with only ignored event
+					// types have nothing to process.
+					debugLog.Println("No jobs in", *msg.MessageId, "job message, deleting")
 					m.DeleteMessage(*msg.ReceiptHandle)
 				}
 			}
@@ -82,12 +120,16 @@ func (m *JobMessageQueue) Listen(doneCh <-chan struct{}) {
 // receiveMsg reads a message from the SQS job queue. A visibility timeout is set
 // so that no other reader will be able to see the message which this service
 // received. Preventing duplication of work. And a wait time provides long pooling
-// so the service does not need to micro manage its pooling of SQS.
+// so the service does not need to micro manage its pooling of SQS. The message's
+// receive count is requested so failed jobs can be retried with a backoff.
 func (m *JobMessageQueue) receiveMsg() ([]*sqs.Message, error) {
 	result, err := m.msgSvc.ReceiveMessage(&sqs.ReceiveMessageInput{
 		QueueUrl:          aws.String(m.queueURL),
-		WaitTimeSeconds:   aws.Int64(m.queueWait),
-		VisibilityTimeout: aws.Int64(m.queueVisibility),
+		WaitTimeSeconds:   aws.Int64(atomic.LoadInt64(&m.queueWait)),
+		VisibilityTimeout: aws.Int64(m.visibilityTimeout()),
+		AttributeNames: []*string{
+			aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
+		},
 	})
 	if err != nil {
 		return nil, err
@@ -111,12 +153,53 @@ func (m *JobMessageQueue) DeleteMessage(receiptHandle string) error {
 // other readers of the SQS job queue. This allows a worker to keep processing
 // a long running job.
 func (m *JobMessageQueue) UpdateMessageVisibility(receiptHandle string) (int64, error) {
+	visibility := m.visibilityTimeout()
 	_, err := m.msgSvc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
 		QueueUrl:          aws.String(m.queueURL),
 		ReceiptHandle:     aws.String(receiptHandle),
-		VisibilityTimeout: aws.Int64(m.queueVisibility),
+		VisibilityTimeout: aws.Int64(visibility),
+	})
+	return visibility, err
+}
+
+// SetTiming changes the visibility timeout, and receive wait time in seconds
+// of messages received from now on. Messages already received keep their
+// visibility timeout until it is next extended.
+func (m *JobMessageQueue) SetTiming(visibilityTime, waitTime int64) {
+	atomic.StoreInt64(&m.queueVisibility, visibilityTime)
+	atomic.StoreInt64(&m.queueWait, waitTime)
+}
+
+// visibilityTimeout returns the current visibility timeout in seconds.
+func (m *JobMessageQueue) visibilityTimeout() int64 {
+	return atomic.LoadInt64(&m.queueVisibility)
+}
+
+// RetryMessage hides a job message from readers of the SQS job queue for a
+// delay based on the number of times the message has been received. Allowing
+// jobs which failed with a transient error to be retried with an exponential
+// backoff instead of immediately.
+func (m *JobMessageQueue) RetryMessage(msg wordfreq.JobMessage) (int64, error) {
+	delay := retryDelay(msg.ReceiveCount)
+	_, err := m.msgSvc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(m.queueURL),
+		ReceiptHandle:     aws.String(msg.ReceiptHandle),
+		VisibilityTimeout: aws.Int64(delay),
 	})
-	return m.queueVisibility, err
+	return delay, err
+}
+
+// retryDelay returns the delay in seconds before a message received
+// receiveCount times should be retried.
+func retryDelay(receiveCount int) int64 {
+	delay := int64(retryBaseDelay)
+	for i := 1; i < receiveCount && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
 }
 
 // GetJobs returns a read only channel to read jobs from. This channel will
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Log levels, in order of increasing severity. Only messages at or above
+// the current log level are written.
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelError = "error"
+)
+
+// logLevels maps the name of each log level to its severity.
+var logLevels = map[string]int32{
+	logLevelDebug: 0,
+	logLevelInfo:  1,
+	logLevelError: 2,
+}
+
+// currentLogLevel is the severity of the current log level. Accessed
+// atomically, so the level can be changed while the worker is running.
+var currentLogLevel = logLevels[logLevelInfo]
+
+// setLogLevel changes the current log level, returning an error if the level
+// is unknown.
+func setLogLevel(level string) error {
+	severity, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %s", level)
+	}
+	atomic.StoreInt32(&currentLogLevel, severity)
+	return nil
+}
+
+// A leveledLogger writes messages of a log level. Debug and info messages are
+// written to stdout, and errors are written to the standard logger.
+type leveledLogger struct {
+	severity int32
+	stdLog   bool
+}
+
+// Loggers of each log level.
+var (
+	debugLog = leveledLogger{severity: logLevels[logLevelDebug]}
+	infoLog  = leveledLogger{severity: logLevels[logLevelInfo]}
+	errorLog = leveledLogger{severity: logLevels[logLevelError], stdLog: true}
+)
+
+// enabled returns if messages of the logger's level are written.
+func (l leveledLogger) enabled() bool {
+	return l.severity >= atomic.LoadInt32(&currentLogLevel)
+}
+
+// Println writes the message if the logger's level is enabled, the same as
+// fmt.Println.
+func (l leveledLogger) Println(a ...interface{}) {
+	if !l.enabled() {
+		return
+	}
+	if l.stdLog {
+		log.Println(a...)
+	} else {
+		fmt.Println(a...)
+	}
+}
+
+// Printf writes the message if the logger's level is enabled, the same as
+// fmt.Printf.
+func (l leveledLogger) Printf(format string, a ...interface{}) {
+	if !l.enabled() {
+		return
+	}
+	if l.stdLog {
+		log.Printf(format, a...)
+	} else {
+		fmt.Printf(format, a...)
+	}
+}
@@ -1,21 +1,44 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/sqs"
 
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
 // Worker service which reads from an SQS queue pulls off job messages, processes
-// the jobs, and records the results. The service uses environment variables for
-// its configuration.
+// the jobs, and records the results. The service is configured by a YAML or JSON
+// config file, environment variables, and command line flags. Flags take
+// precedence over environment variables, which take precedence over the config
+// file. Each environment variable has a matching config file key, the variable
+// without its WORKER_ or AWS_ prefix in lower case, e.g. WORKER_QUEUE_URL is
+// queue_url, except WORKER_COUNT which is worker_count. Each flag is the config
+// file key with dashes, e.g. -queue-url. Secrets, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, have no flag. Run with -h to list all flags.
+//
+// Usage:
+//  worker [-config file] [-print-config] [flags]
+//
+// The config file is set by the -config flag, or the WORKER_CONFIG_FILE
+// environment variable. Files with the .json extension are JSON, otherwise the
+// file is YAML. -print-config prints the effective configuration, and the source
+// of each value, with secrets redacted, and exits, even if required settings
+// are missing.
+//
+// On SIGHUP the worker reloads its configuration. The worker pool is resized,
+// removed workers finishing their current job first, and the visibility
+// timeout, receive wait, memory budget, job option defaults, and log level are
+// replaced without dropping any jobs. Changes to other settings are logged, and
+// require a restart.
 //
 // Requires the following environment variables to be set.
 //
@@ -35,6 +58,11 @@ import (
 // requests to. This parameter is only optional if the service is running within
 // an EC2 instance. If not running in an EC2 instance AWS_REGION is required.
 //
+// * WORKER_REPLY_TO_PREFIXES - Comma separated list of SQS queue URL prefixes
+// results can be sent to when a job sets a reply to queue. Results of jobs with
+// other reply to queues are sent to the result queue. Defaults to the
+// "wordfreq-reply-" queues in the same account as the result queue.
+//
 // * WORKER_MESSAGE_VISIBILITY - The ammount of time messges will be hidden in
 // the SQS job message queue from other services when a service reads that message.
 // Will also be used to extend the visibility timeout for long running jobs.
@@ -43,27 +71,106 @@ import (
 // * WORKER_COUNT - The number of workers in the worker pool. Defaults to the
 // number of virtual CPUs in the system.
 //
+// * WORKER_EVENT_TYPES - Comma separated list of S3 event types the worker will
+// process, e.g. "ObjectCreated:*,ObjectRemoved:Delete". ObjectCreated events
+// count the object's words, and ObjectRemoved events remove the object's result.
+// Defaults to "ObjectCreated:*,ObjectRemoved:*".
+//
+// * WORKER_HISTORY_TABLENAME - The name of the DynamoDB table every attempt to
+// process a job is recorded to, with the hash key Filename, and range key
+// Attempt. If not set the history is not recorded.
+//
+// * WORKER_HISTOGRAM_BUCKET - The S3 bucket the full histogram of words counted
+// for each job will be written to. If not set histograms will not be written.
+//
+// * WORKER_HISTOGRAM_PREFIX - The key prefix histograms will be written under.
+// Each histogram's key is followed by the version of the file counted.
+//
+// * WORKER_HISTOGRAM_FORMAT - The format histograms are written in, "json" or
+// "csv". Histograms are gzip compressed. Defaults to "json".
+//
+// * WORKER_AGGREGATE_TABLENAME - The name of the DynamoDB table the words counted
+// for each job will be added to, aggregated by bucket and key prefix. If not set
+// aggregate word counts will not be recorded.
+//
+// * WORKER_MEMORY_BUDGET - The approximate number of bytes the word counts of
+// each job may use before they are spilled to disk, and merged once the job's
+// words are all counted. Each worker has its own budget. If not set, or 0,
+// word counts are never spilled.
+//
+// * WORKER_SPILL_DIR - The directory spilled word counts, and histograms are
+// written to. Defaults to the system's temporary directory.
+//
+// * WORKER_RECEIVE_WAIT - The number of seconds a receive from the job queue
+// waits for messages to arrive, up to 20. Defaults to 5.
+//
+// * WORKER_JOB_BUFFER, WORKER_RESULT_BUFFER - The number of jobs buffered for
+// the workers, and results buffered for the result collector. Default to 10.
+//
+// * WORKER_TOP, WORKER_MIN_WORD_LENGTH, WORKER_MAX_WORD_LENGTH,
+// WORKER_LONG_WORD_POLICY - The options jobs are counted with if the job does
+// not set them. Default to 10, 5, 1024, and "skip". The maximum word length
+// must be at least 4, and not less than the minimum word length.
+//
+// * WORKER_LOG_LEVEL - The level of messages logged, "debug", "info", or
+// "error". Defaults to "info".
+//
+// * AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN - Static AWS
+// credentials. If not set the SDK's default credentials are used.
+//
 func main() {
+	// SIGHUP is handled before anything else, so a reload requested while
+	// the worker is starting does not terminate it.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
 	doneCh := listenForSigInterrupt()
 
-	cfg, err := getConfig()
-	if err != nil {
+	cfg, err := getConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
 		log.Println("Unable to get config", err)
 		os.Exit(1)
 	}
+	if cfg.PrintConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+	setLogLevel(cfg.LogLevel)
+
+	resultsCh := make(chan *wordfreq.JobResult, cfg.ResultBuffer)
 
 	sqsSvc := sqs.New(cfg.Session)
-	queue := NewJobMessageQueue(cfg.WorkerQueueURL, cfg.MessageVisibilityTimeout, 5, sqsSvc)
+	queue := NewJobMessageQueue(cfg.WorkerQueueURL, cfg.MessageVisibilityTimeout, cfg.ReceiveWait, cfg.JobBuffer, cfg.EventTypes, resultsCh, sqsSvc)
 	go queue.Listen(doneCh)
 
+	// Recorder to write results to Amazon DynamoDB
+	dynamoDBSvc := dynamodb.New(cfg.Session)
+	recorder := NewResultRecorder(cfg.ResultTableName, cfg.HistoryTableName, dynamoDBSvc)
+
+	// Optional writer of full word histograms to Amazon S3
+	var histograms *HistogramWriter
+	if cfg.HistogramBucket != "" {
+		histograms = NewHistogramWriter(cfg.HistogramBucket, cfg.HistogramPrefix,
+			cfg.HistogramFormat, cfg.SpillDir, s3manager.NewUploader(cfg.Session))
+	}
+
+	// Optional recorder of aggregate word counts to Amazon DynamoDB
+	var aggregates *AggregateRecorder
+	if cfg.AggregateTableName != "" {
+		aggregates = NewAggregateRecorder(cfg.AggregateTableName, dynamoDBSvc)
+	}
+
 	// Job Workers
-	resultsCh := make(chan *wordfreq.JobResult, 10)
-	workers := NewWorkerPool(cfg.NumWorkers, resultsCh, queue, s3.New(cfg.Session))
+	counter := wordfreq.WordCounter{MemoryBudget: cfg.MemoryBudget, TempDir: cfg.SpillDir}
+	workers := NewWorkerPool(cfg.NumWorkers, resultsCh, queue, recorder, NewS3Clients(cfg.Session), counter, cfg.Options, histograms, aggregates)
+
+	// Reload the config on SIGHUP, resizing the worker pool, and applying
+	// the other settings which can change without a restart.
+	go NewReloader(os.Args[1:], cfg, queue, workers).Listen(hupCh, doneCh)
 
 	// Notifier to send a message to an Amazon SQS Queue
-	notify := NewResultNotifier(sqsSvc, cfg.ResultQueueURL)
-	// Recorder to write results to Amazon DynamoDB
-	recorder := NewResultRecorder(cfg.ResultTableName, dynamodb.New(cfg.Session))
+	notify := NewResultNotifier(sqsSvc, cfg.ResultQueueURL, cfg.ReplyToPrefixes)
 
 	// Job Progress Collector
 	collector := NewResultCollector(notify, recorder, queue)
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// reloadableSettings are the names of the settings which take effect when the
+// configuration is reloaded. Changes to other settings require a restart.
+var reloadableSettings = map[string]bool{
+	"worker_count":       true,
+	"message_visibility": true,
+	"receive_wait":       true,
+	"memory_budget":      true,
+	"top":                true,
+	"min_word_length":    true,
+	"max_word_length":    true,
+	"long_word_policy":   true,
+	"log_level":          true,
+}
+
+// A Reloader reloads the worker's configuration, and applies the settings
+// which can be changed without restarting to the running components.
+type Reloader struct {
+	args    []string
+	cfg     Config
+	queue   *JobMessageQueue
+	workers *WorkerPool
+}
+
+// NewReloader creates a Reloader of the configuration the components were
+// created with. The configuration is reloaded from the same command line
+// arguments.
+func NewReloader(args []string, cfg Config, queue *JobMessageQueue, workers *WorkerPool) *Reloader {
+	return &Reloader{args: args, cfg: cfg, queue: queue, workers: workers}
+}
+
+// Listen reloads the configuration each time a signal is received on the
+// signal channel, until the done channel is closed.
+func (r *Reloader) Listen(sigCh <-chan os.Signal, doneCh <-chan struct{}) {
+	for {
+		select {
+		case <-doneCh:
+			return
+		case sig := <-sigCh:
+			infoLog.Printf("Received %s, reloading config\n", sig)
+			if err := r.Reload(); err != nil {
+				errorLog.Println("Unable to reload config, keeping current config,", err)
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again, and applies the reloadable settings.
+// If the configuration is invalid, none of the settings are applied. Since
+// environment variables and flags can not change while the worker is running,
+// only changes to the config file take effect. Changes to settings in the
+// config file which are overridden by an environment variable or flag are
+// logged, since they do not take effect.
+func (r *Reloader) Reload() error {
+	next, err := loadConfig(r.args)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range settings {
+		if r.cfg.values[s.name] != next.values[s.name] && !reloadableSettings[s.name] {
+			infoLog.Println("Setting", s.name, "changed, restart the worker for it to take effect")
+		}
+
+		fileValue, inFile := next.fileValues[s.name]
+		prevFileValue, wasInFile := r.cfg.fileValues[s.name]
+		if !inFile || (wasInFile && fileValue == prevFileValue) {
+			continue
+		}
+		if v := next.values[s.name]; !strings.HasPrefix(v.source, sourceFile) {
+			value := strconv.Quote(v.value)
+			fileValue = strconv.Quote(fileValue)
+			if s.secret {
+				value, fileValue = redacted, redacted
+			}
+			infoLog.Printf("Setting %s changed in config file to %s, but is overridden by %s, keeping %s\n",
+				s.name, fileValue, v.source, value)
+		}
+	}
+
+	setLogLevel(next.LogLevel)
+	r.queue.SetTiming(next.MessageVisibilityTimeout, next.ReceiveWait)
+	r.workers.SetJobSettings(
+		wordfreq.WordCounter{MemoryBudget: next.MemoryBudget, TempDir: r.cfg.SpillDir},
+		next.Options,
+	)
+	if size := r.workers.Size(); size != next.NumWorkers {
+		infoLog.Printf("Resizing worker pool from %d to %d workers\n", size, next.NumWorkers)
+		r.workers.Resize(next.NumWorkers)
+	}
+
+	// Only the reloadable settings are in effect, other settings keep the
+	// values the worker was started with.
+	values := map[string]configValue{}
+	for name, v := range r.cfg.values {
+		values[name] = v
+	}
+	for name := range reloadableSettings {
+		if v, ok := next.values[name]; ok {
+			values[name] = v
+		} else {
+			delete(values, name)
+		}
+	}
+	r.cfg.NumWorkers = next.NumWorkers
+	r.cfg.MessageVisibilityTimeout = next.MessageVisibilityTimeout
+	r.cfg.ReceiveWait = next.ReceiveWait
+	r.cfg.MemoryBudget = next.MemoryBudget
+	r.cfg.Options = next.Options
+	r.cfg.LogLevel = next.LogLevel
+	r.cfg.values = values
+	r.cfg.fileValues = next.fileValues
+
+	infoLog.Println("Reloaded config")
+	return nil
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"sync"
 
 	"github.com/awslabs/aws-go-wordfreq-sample"
@@ -30,12 +29,18 @@ func NewResultCollector(notify *ResultNotifier, recorder *ResultRecorder, queue
 // ProcessJobResult waits for job results to be received from the results channel,
 // until the result channel is closed, and drained. Successful results will be
 // recorded to DynamoDB, and the original job message deleted from the SQS job
-// message queue. Regardless if the job was successful or not the status will be
-// reported to an SQS result queue for further processing.
+// message queue. Failed results are also recorded so the table has the status
+// of all jobs, without replacing successful results, and every attempt is
+// recorded to the history table if the worker has one. Jobs which failed
+// permanently will also have their message deleted since retrying them would
+// never succeed. Jobs which failed with a transient error have their message
+// hidden for a backoff delay so they can be retried later. Completed jobs,
+// successful or permanently failed, will have their status reported to an SQS
+// result queue for further processing.
 func (r *ResultCollector) ProcessJobResult(resultCh <-chan *wordfreq.JobResult) {
 	r.wg.Add(1)
-	fmt.Println("Job Result Collector starting.")
-	defer fmt.Println("Job Result Collector quiting.")
+	infoLog.Println("Job Result Collector starting.")
+	defer infoLog.Println("Job Result Collector quiting.")
 	defer r.wg.Done()
 
 	for {
@@ -44,36 +49,106 @@ func (r *ResultCollector) ProcessJobResult(resultCh <-chan *wordfreq.JobResult)
 			return
 		}
 		message := result.Job.OrigMessage
-		fmt.Println("Recived job result", message.ID)
+		debugLog.Println("Recived job result", message.ID)
+
+		if result.Status == wordfreq.JobCompleteSkipped {
+			// Duplicate jobs were already recorded and reported, so only
+			// the message needs to be deleted.
+			infoLog.Println("Skipped duplicate job", message.ID)
+			r.recordHistory(result)
+			r.deleteMessage(message)
+			continue
+		}
 
 		if result.Status == wordfreq.JobCompleteSuccess {
-			fmt.Println("Succesffuly processed job", message.ID)
+			if result.Job.Action == wordfreq.JobActionRemove {
+				infoLog.Println("Removing result for job", message.ID)
+			} else {
+				infoLog.Println("Succesffuly processed job", message.ID)
+			}
 
 			// Record result to dynamoDB, and delete message if successful
 			// if the writing to dynamoDB fails, don't delete the message
-			// so the job can be retried by another worker later.
-			if err := r.recorder.Record(result); err != nil {
+			// so the job can be retried by another worker later. If a result
+			// for a newer event was recorded first, this result is stale.
+			if err := r.recorder.Record(result); err == errResultSuperseded {
+				infoLog.Println("Result superseded by newer event, skipping", message.ID)
+				r.recordHistory(result)
+				r.deleteMessage(message)
+				continue
+			} else if err != nil {
 				result.Status = wordfreq.JobCompleteFailure
 				result.StatusMessage = fmt.Sprintf("record results failed, %v", err)
-				log.Println("failed to recored result", message.ID, err)
+				result.ErrorCode = wordfreq.ErrTransient
+				errorLog.Println("failed to recored result", message.ID, err)
 			} else {
-				err := r.queue.DeleteMessage(message.ReceiptHandle)
-				if err != nil {
-					log.Println("Failed to delete message,", message.ID, err)
-				}
-				fmt.Println("Deleted message,", message.ID)
+				r.deleteMessage(message)
 			}
 
+		} else if !result.ErrorCode.Retryable() {
+			errorLog.Println("Failed to process job", message.ID, "permanently,", result.ErrorCode)
+			r.recordFailure(result)
+			r.deleteMessage(message)
 		} else {
-			log.Println("Failed to process job", message.ID)
+			errorLog.Println("Failed to process job", message.ID)
+			r.recordFailure(result)
+		}
+
+		r.recordHistory(result)
+
+		// Transient failures will be retried, so the result is not reported
+		// until the job either completes or fails permanently.
+		if result.Status == wordfreq.JobCompleteFailure && result.ErrorCode.Retryable() {
+			delay, err := r.queue.RetryMessage(message)
+			if err != nil {
+				errorLog.Println("Failed to delay message retry,", message.ID, err)
+			} else {
+				infoLog.Printf("Retrying message %s in %ds\n", message.ID, delay)
+			}
+			continue
 		}
 
 		if err := r.notify.Send(result); err != nil {
-			log.Println("Failed to send result to SQS queue", err)
+			errorLog.Println("Failed to send result to SQS queue", err)
 		}
 	}
 }
 
+// recordFailure records the failed job result to DynamoDB so the table has
+// the status of all jobs. Since the job has already failed, errors recording
+// the result are only logged.
+func (r *ResultCollector) recordFailure(result *wordfreq.JobResult) {
+	if result.Job.Bucket == "" || result.Job.Key == "" {
+		// Rejected jobs may not have an object to record the result for.
+		return
+	}
+	if err := r.recorder.Record(result); err != nil && err != errResultSuperseded {
+		errorLog.Println("Failed to record failed result,", result.Job.OrigMessage.ID, err)
+	}
+}
+
+// recordHistory records the attempt to process the job to the history table,
+// if the worker has one. Errors recording the history are only logged, since
+// the job's result has already been handled.
+func (r *ResultCollector) recordHistory(result *wordfreq.JobResult) {
+	if result.Job.Bucket == "" || result.Job.Key == "" {
+		return
+	}
+	if err := r.recorder.RecordHistory(result); err != nil {
+		errorLog.Println("Failed to record job history,", result.Job.OrigMessage.ID, err)
+	}
+}
+
+// deleteMessage deletes the job message from the SQS job queue so that the
+// job will not be processed again.
+func (r *ResultCollector) deleteMessage(message wordfreq.JobMessage) {
+	if err := r.queue.DeleteMessage(message.ReceiptHandle); err != nil {
+		errorLog.Println("Failed to delete message,", message.ID, err)
+		return
+	}
+	debugLog.Println("Deleted message,", message.ID)
+}
+
 // WaitForResults wait for the results collector to finish processing job
 // results before returning.
 func (r *ResultCollector) WaitForResults() {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
@@ -10,33 +11,79 @@ import (
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
+// replyQueuePrefix is the name prefix of the reply queues created by uploads3.
+const replyQueuePrefix = "wordfreq-reply-"
+
 // A ResultNotifier provides pushing a result message to the SQS results queue.
 type ResultNotifier struct {
-	svc      sqsiface.SQSAPI
-	queueURL string
+	svc             sqsiface.SQSAPI
+	queueURL        string
+	replyToPrefixes []string
 }
 
 // NewResultNotifier creates a new instance of the ResultNotifier type with the
-// Amazon SQS service client and queue URL messages will sent to.
-func NewResultNotifier(svc sqsiface.SQSAPI, queueURL string) *ResultNotifier {
+// Amazon SQS service client and queue URL messages will sent to. Results are
+// only sent to a job's reply to queue if its URL has one of the prefixes. If no
+// prefixes are provided, the reply queues in the same account as the queue URL
+// are allowed.
+func NewResultNotifier(svc sqsiface.SQSAPI, queueURL string, replyToPrefixes []string) *ResultNotifier {
+	if len(replyToPrefixes) == 0 {
+		// Queue URLs end with the account ID, and the queue's name.
+		accountURL := queueURL[:strings.LastIndex(queueURL, "/")+1]
+		replyToPrefixes = []string{accountURL + replyQueuePrefix}
+	}
 	return &ResultNotifier{
-		svc: svc, queueURL: queueURL,
+		svc: svc, queueURL: queueURL, replyToPrefixes: replyToPrefixes,
 	}
 }
 
-// Send sends a message to the Amazon SQS queue with the job's result.
+// Send sends a message to the Amazon SQS queue with the job's result. If the
+// job has an allowed reply to queue URL the result is sent to that queue
+// instead. The job's correlation ID is included as a message attribute.
 func (r *ResultNotifier) Send(result *wordfreq.JobResult) error {
 	msg, err := json.Marshal(result)
 	if err != nil {
 		return err
 	}
 
-	_, err = r.svc.SendMessage(&sqs.SendMessageInput{
-		QueueUrl:    aws.String(r.queueURL),
+	queueURL := r.queueURL
+	if replyTo := result.Job.ReplyTo; replyTo != "" {
+		if r.allowedReplyTo(replyTo) {
+			queueURL = replyTo
+		} else {
+			errorLog.Printf("Reply to queue %s of job %s not allowed, sending result to result queue\n",
+				replyTo, result.Job.OrigMessage.ID)
+		}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
 		MessageBody: aws.String(string(msg)),
-	})
+	}
+	if result.Job.CorrelationID != "" {
+		// The correlation ID is also sent as an attribute so receivers can
+		// match results without unmarshaling the message body.
+		input.MessageAttributes = map[string]*sqs.MessageAttributeValue{
+			wordfreq.CorrelationIDAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(result.Job.CorrelationID),
+			},
+		}
+	}
+
+	_, err = r.svc.SendMessage(input)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// allowedReplyTo returns if results can be sent to the reply to queue URL.
+func (r *ResultNotifier) allowedReplyTo(replyTo string) bool {
+	for _, prefix := range r.replyToPrefixes {
+		if strings.HasPrefix(replyTo, prefix) {
+			return true
+		}
+	}
+	return false
+}
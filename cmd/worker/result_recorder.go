@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
@@ -12,32 +15,48 @@ import (
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
+// errResultSuperseded is returned by Record when a result for the same or a
+// newer version of the object has already been recorded.
+var errResultSuperseded = errors.New("result superseded by newer or duplicate result")
+
 // A ResultRecorder provides the an abstraction to record job results to DynamoDB.
 type ResultRecorder struct {
-	tableName string
-	svc       dynamodbiface.DynamoDBAPI
+	tableName        string
+	historyTableName string
+	host             string
+	svc              dynamodbiface.DynamoDBAPI
 }
 
 // NewResultRecorder creates a new instance of the ResultRecorder configured
-// with a DynamoDB service client.
-func NewResultRecorder(tableName string, svc dynamodbiface.DynamoDBAPI) *ResultRecorder {
+// with a DynamoDB service client. The host the worker is running on is
+// included in each result recorded. The history table is optional, if set
+// every attempt to process a job is also recorded to it.
+func NewResultRecorder(tableName, historyTableName string, svc dynamodbiface.DynamoDBAPI) *ResultRecorder {
+	host, _ := os.Hostname()
 	return &ResultRecorder{
-		tableName: tableName,
-		svc:       svc,
+		tableName:        tableName,
+		historyTableName: historyTableName,
+		host:             host,
+		svc:              svc,
 	}
 }
 
 // Record marshals the job result into a dynamodb.AttributeValue struct, and writes
-// the result item to DyanmoDB.
+// the result item to DyanmoDB. The result table holds the latest result of each
+// object. Both successful and failed results are recorded.
+//
+// If the job has an S3 event sequencer the item is only written if no result
+// exists yet, the existing result is for an older event, or the existing result
+// is a failure of the same event. A failed result never replaces a successful
+// result of the same event, or a successful result without a sequencer, so a
+// failed retry cannot overwrite the words already counted. errResultSuperseded
+// is returned if the write was rejected.
+//
+// Results of remove jobs are recorded as a tombstone item without words, so
+// that an older, out of order, event cannot recreate the removed result.
 func (r *ResultRecorder) Record(result *wordfreq.JobResult) error {
 	// Construct a result item representing what data we want to write to DynamoDB.
-	recordItem := resultRecord{
-		Filename: path.Join(result.Job.Bucket, result.Job.Key),
-		Words:    map[string]int{},
-	}
-	for _, w := range result.Words {
-		recordItem.Words[w.Word] = w.Count
-	}
+	recordItem := wordfreq.NewResultRecord(result, r.host)
 
 	// Use the ConvertToX helpers to marshal a Go struct to a dyanmodb.AttributeValue
 	// type. This greatly simplifies the code needed to create the attribute
@@ -46,19 +65,107 @@ func (r *ResultRecorder) Record(result *wordfreq.JobResult) error {
 	if err != nil {
 		return fmt.Errorf("unable to serialize result to dyanmoDB.AttributeValue, %v", err)
 	}
-	_, err = r.svc.PutItem(&dynamodb.PutItemInput{
+	input := &dynamodb.PutItemInput{
 		TableName: aws.String(r.tableName),
 		Item:      av,
-	})
+	}
+	failed := result.Status == wordfreq.JobCompleteFailure
+	if recordItem.Sequencer != "" {
+		// Sequencers are normalized to the same length when parsed so they
+		// can be compared as strings. Failed results of the same event are
+		// overwritten when the job is retried. Successful items without a
+		// sequencer were written by a job that had none, and are only
+		// overwritten by successful results.
+		cond := "attribute_not_exists(Filename) OR Sequencer < :sequencer OR " +
+			"(#status = :failure AND (attribute_not_exists(Sequencer) OR Sequencer = :sequencer))"
+		if !failed {
+			cond += " OR attribute_not_exists(Sequencer)"
+		}
+		input.ConditionExpression = aws.String(cond)
+		input.ExpressionAttributeNames = map[string]*string{
+			"#status": aws.String("Status"),
+		}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":sequencer": {S: aws.String(recordItem.Sequencer)},
+			":failure":   {S: aws.String(string(wordfreq.JobCompleteFailure))},
+		}
+	} else if failed {
+		// Without a sequencer the failure can not be ordered against the
+		// recorded result, so it only replaces other failures.
+		input.ConditionExpression = aws.String("attribute_not_exists(Filename) OR #status = :failure")
+		input.ExpressionAttributeNames = map[string]*string{
+			"#status": aws.String("Status"),
+		}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":failure": {S: aws.String(string(wordfreq.JobCompleteFailure))},
+		}
+	}
+
+	_, err = r.svc.PutItem(input)
 	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return errResultSuperseded
+		}
 		return fmt.Errorf("unable to record result, %v", err)
 	}
 
 	return nil
 }
 
-// a resultRecord represents the result item in DynamoDB.
-type resultRecord struct {
-	Filename string // Table hash key
-	Words    map[string]int
+// RecordHistory writes the job result as a new item of the history table, so
+// the table holds every attempt to process each object, successful or not.
+// Nothing is written if the recorder does not have a history table.
+func (r *ResultRecorder) RecordHistory(result *wordfreq.JobResult) error {
+	if r.historyTableName == "" {
+		return nil
+	}
+
+	av, err := dynamodbattribute.ConvertToMap(wordfreq.NewHistoryRecord(result, r.host))
+	if err != nil {
+		return fmt.Errorf("unable to serialize history to dyanmoDB.AttributeValue, %v", err)
+	}
+	_, err = r.svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(r.historyTableName),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record history, %v", err)
+	}
+	return nil
+}
+
+// IsDuplicate returns if a result has already been recorded for the job's S3
+// event, or for a newer event of the same object. Failed results of the same
+// event are not duplicates, so the job can be retried. Jobs without a sequencer
+// are never considered duplicates.
+func (r *ResultRecorder) IsDuplicate(job *wordfreq.Job) (bool, error) {
+	if job.Sequencer == "" {
+		return false, nil
+	}
+
+	resp, err := r.svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Filename": {S: aws.String(path.Join(job.Bucket, job.Key))},
+		},
+		ProjectionExpression: aws.String("Sequencer, #status"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to get recorded result, %v", err)
+	}
+
+	recorded, ok := resp.Item["Sequencer"]
+	if !ok {
+		return false, nil
+	}
+	sequencer := aws.StringValue(recorded.S)
+	if sequencer == job.Sequencer {
+		status, ok := resp.Item["Status"]
+		return !ok || aws.StringValue(status.S) != string(wordfreq.JobCompleteFailure), nil
+	}
+	return sequencer > job.Sequencer, nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/awslabs/aws-go-wordfreq-sample"
+)
+
+// A S3Clients provides Amazon S3 service clients for the region of a job's
+// bucket. Clients are created when first needed for a region, and reused for
+// all later jobs in that region. Since objects must be read from the region
+// their bucket is in, using the worker's own region for all jobs would fail,
+// or require redirects for buckets in other regions.
+type S3Clients struct {
+	sess *session.Session
+
+	mu            sync.Mutex
+	clients       map[string]s3iface.S3API
+	bucketRegions map[string]string
+}
+
+// NewS3Clients creates a new instance of the S3Clients, which will create
+// service clients from the session provided.
+func NewS3Clients(sess *session.Session) *S3Clients {
+	return &S3Clients{
+		sess:          sess,
+		clients:       map[string]s3iface.S3API{},
+		bucketRegions: map[string]string{},
+	}
+}
+
+// ForJob returns the S3 service client for the job's region. If the job does
+// not have a region the region of the job's bucket is discovered, and set on
+// the job.
+func (c *S3Clients) ForJob(job *wordfreq.Job) (s3iface.S3API, error) {
+	if job.Region == "" {
+		region, err := c.bucketRegion(job.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		job.Region = region
+	}
+
+	return c.forRegion(job.Region), nil
+}
+
+// forRegion returns the service client for the region, creating it if a
+// client for the region has not been created yet.
+func (c *S3Clients) forRegion(region string) s3iface.S3API {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if svc, ok := c.clients[region]; ok {
+		return svc
+	}
+
+	svc := s3.New(c.sess, &aws.Config{Region: aws.String(region)})
+	c.clients[region] = svc
+	return svc
+}
+
+// bucketRegion returns the region the bucket is in. Regions discovered are
+// cached so the lookup is only made once per bucket.
+func (c *S3Clients) bucketRegion(bucket string) (string, error) {
+	c.mu.Lock()
+	region, ok := c.bucketRegions[bucket]
+	c.mu.Unlock()
+	if ok {
+		return region, nil
+	}
+
+	region, err := s3manager.GetBucketRegion(aws.BackgroundContext(), c.sess, bucket,
+		aws.StringValue(c.sess.Config.Region))
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.bucketRegions[bucket] = region
+	c.mu.Unlock()
+
+	return region, nil
+}
@@ -1,183 +1,400 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"log"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 
 	"github.com/awslabs/aws-go-wordfreq-sample"
 )
 
 // A WorkerPool provides a collection of workers, and access to their lifecycle.
+// The pool can be resized, and the settings jobs are processed with replaced,
+// while its workers are running.
 type WorkerPool struct {
+	mu      sync.Mutex
 	workers []*Worker
+	nextID  int
 	wg      sync.WaitGroup
+	// Set once the pool is waited on, after which it can not be resized.
+	closed bool
+
+	// Creates a new worker with the id.
+	newWorker func(id int) *Worker
+	// jobSettings jobs are processed with, shared by all workers.
+	settings atomic.Value
+}
+
+// jobSettings are the settings the workers process jobs with.
+type jobSettings struct {
+	// Counts the words of each job, within the memory budget.
+	counter wordfreq.WordCounter
+	// Options jobs are counted with, if the job does not set them.
+	options wordfreq.AnalysisOptions
 }
 
 // NewWorkerPool creates a new instance of the worker pool, and creates all the
 // workers in the pool. The workers are spun off in their own goroutines and the
 // WorkerPool's wait group is used to know when the workers all completed their
 // work and existed.
-func NewWorkerPool(size int, resultCh chan<- *wordfreq.JobResult, queue *JobMessageQueue, s3svc s3iface.S3API) *WorkerPool {
-	pool := &WorkerPool{
-		workers: make([]*Worker, size),
+func NewWorkerPool(size int, resultCh chan<- *wordfreq.JobResult, queue *JobMessageQueue, recorder *ResultRecorder, s3Clients *S3Clients, counter wordfreq.WordCounter, options wordfreq.AnalysisOptions, histograms *HistogramWriter, aggregates *AggregateRecorder) *WorkerPool {
+	pool := &WorkerPool{}
+	pool.settings.Store(jobSettings{counter: counter, options: options})
+	pool.newWorker = func(id int) *Worker {
+		return NewWorker(id, resultCh, queue, recorder, s3Clients, &pool.settings, histograms, aggregates)
 	}
 
-	for i := 0; i < len(pool.workers); i++ {
-		pool.wg.Add(1)
-		pool.workers[i] = NewWorker(i, resultCh, queue, s3svc)
+	pool.Resize(size)
+
+	return pool
+}
+
+// Resize grows or shrinks the pool to the number of workers. Workers removed
+// from the pool finish the job they are processing before they quit, and jobs
+// they have not started are left for the remaining workers. Once the pool is
+// waited on for its workers to be done it is no longer resized.
+func (w *WorkerPool) Resize(size int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Workers can not be added once the wait group is waited on.
+	if w.closed {
+		infoLog.Println("Worker pool is shutting down, not resizing")
+		return
+	}
 
-		go func(worker *Worker) {
+	for len(w.workers) < size {
+		worker := w.newWorker(w.nextID)
+		w.nextID++
+		w.workers = append(w.workers, worker)
+
+		w.wg.Add(1)
+		go func() {
 			worker.run()
-			pool.wg.Done()
-		}(pool.workers[i])
+			w.wg.Done()
+		}()
+	}
+	for len(w.workers) > size {
+		last := len(w.workers) - 1
+		w.workers[last].stop()
+		w.workers = w.workers[:last]
 	}
+}
 
-	return pool
+// Size returns the number of workers in the pool.
+func (w *WorkerPool) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.workers)
+}
+
+// SetJobSettings replaces the word counter, and default options jobs are
+// processed with. Jobs already being processed keep the settings they
+// started with.
+func (w *WorkerPool) SetJobSettings(counter wordfreq.WordCounter, options wordfreq.AnalysisOptions) {
+	w.settings.Store(jobSettings{counter: counter, options: options})
 }
 
 // WaitForWorkersDone waits for the works to of all completed their work and
-// exited.
+// exited. The pool can not be resized once it is waited on.
 func (w *WorkerPool) WaitForWorkersDone() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
 	w.wg.Wait()
 }
 
 // A Worker is a individual processor of jobs from the job channel.
 type Worker struct {
-	id       int
-	resultCh chan<- *wordfreq.JobResult
-	queue    *JobMessageQueue
-	s3Svc    s3iface.S3API
+	id        int
+	resultCh  chan<- *wordfreq.JobResult
+	queue     *JobMessageQueue
+	recorder  *ResultRecorder
+	s3Clients *S3Clients
+	// jobSettings jobs are processed with, which may be replaced while
+	// the worker is running.
+	settings *atomic.Value
+	// Closed when the worker is removed from its pool.
+	quitCh chan struct{}
+
+	// Optional, writes the full histogram of words counted to S3.
+	histograms *HistogramWriter
+	// Optional, adds the words counted to the corpus wide aggregate counts.
+	aggregates *AggregateRecorder
 }
 
-// NewWorker creates an initializes a new worker.
-func NewWorker(id int, resultCh chan<- *wordfreq.JobResult, queue *JobMessageQueue, s3Svc s3iface.S3API) *Worker {
-	return &Worker{id: id, resultCh: resultCh, queue: queue, s3Svc: s3Svc}
+// NewWorker creates an initializes a new worker. The settings must hold the
+// jobSettings jobs are processed with. The histogram writer and aggregate
+// recorder are optional and may be nil.
+func NewWorker(id int, resultCh chan<- *wordfreq.JobResult, queue *JobMessageQueue, recorder *ResultRecorder, s3Clients *S3Clients, settings *atomic.Value, histograms *HistogramWriter, aggregates *AggregateRecorder) *Worker {
+	return &Worker{id: id, resultCh: resultCh, queue: queue, recorder: recorder, s3Clients: s3Clients, settings: settings, quitCh: make(chan struct{}), histograms: histograms, aggregates: aggregates}
 }
 
-// run reads from the job channel until it is closed and drained.
+// stop signals the worker to quit once it finishes its current job.
+func (w *Worker) stop() {
+	close(w.quitCh)
+}
+
+// run reads from the job channel until it is closed and drained, or the
+// worker is stopped.
 func (w *Worker) run() {
-	fmt.Printf("Worker %d starting\n", w.id)
-	defer fmt.Printf("Worker %d quitting.\n", w.id)
+	infoLog.Printf("Worker %d starting\n", w.id)
+	defer infoLog.Printf("Worker %d quitting.\n", w.id)
 
 	for {
-		job, ok := <-w.queue.GetJobs()
+		// A stopped worker quits before taking another job, even if jobs
+		// are waiting.
+		select {
+		case <-w.quitCh:
+			return
+		default:
+		}
+
+		var job *wordfreq.Job
+		var ok bool
+		select {
+		case job, ok = <-w.queue.GetJobs():
+		case <-w.quitCh:
+			return
+		}
 		if !ok {
 			return
 		}
-		fmt.Printf("Worker %d received job %s\n", w.id, job.OrigMessage.ID)
+		// Jobs may wait in the job channel, so the job starts once a
+		// worker takes it.
+		job.StartedAt = time.Now()
+		debugLog.Printf("Worker %d received job %s\n", w.id, job.OrigMessage.ID)
 		result := &wordfreq.JobResult{
 			Job: job,
 		}
 
-		// Stream the file from S3, counting the words and return the words
-		// and error if one occurred. If an error occurred the words will be
-		// ignored, and a failed result status is set. Otherwise the success
-		// status is set along with the words.
-		words, err := w.processJob(job)
-		if err != nil {
+		// S3 event notifications are delivered at least once, so the same
+		// event may be received multiple times. Skip counting the object if
+		// a result for this, or a newer, event has already been recorded.
+		if dup, err := w.recorder.IsDuplicate(job); err != nil {
+			errorLog.Println("Unable to check for duplicate job", job.OrigMessage.ID, err)
+		} else if dup {
+			infoLog.Printf("Worker %d skipping duplicate job %s\n", w.id, job.OrigMessage.ID)
+			result.Status = wordfreq.JobCompleteSkipped
+			result.FinishedAt = time.Now()
+			result.Duration = result.FinishedAt.Sub(job.StartedAt)
+			w.resultCh <- result
+			continue
+		}
+
+		// Removed objects have nothing to count, the result collector
+		// will remove the object's recorded result.
+		if job.Action == wordfreq.JobActionRemove {
+			result.Status = wordfreq.JobCompleteSuccess
+			result.FinishedAt = time.Now()
+			result.Duration = result.FinishedAt.Sub(job.StartedAt)
+			w.resultCh <- result
+			continue
+		}
+
+		// Stream the file from S3, counting the words into the result and
+		// return error if one occurred. If an error occurred the words will
+		// be ignored, and a failed result status is set along with the error's
+		// code. Otherwise the success status is set.
+		if err := w.processJob(result); err != nil {
 			result.Status = wordfreq.JobCompleteFailure
 			result.StatusMessage = err.Error()
-			log.Println("Failed to process job", job.OrigMessage.ID, err)
+			result.ErrorCode = wordfreq.GetJobErrorCode(err)
+			result.Words = nil
+			errorLog.Println("Failed to process job", job.OrigMessage.ID, err)
 		} else {
 			result.Status = wordfreq.JobCompleteSuccess
-			result.Words = words
 		}
 		// The duration is collected so that the results can report the
 		// the amount of time a job took to process.
-		result.Duration = time.Now().Sub(job.StartedAt)
+		result.FinishedAt = time.Now()
+		result.Duration = result.FinishedAt.Sub(job.StartedAt)
 		w.resultCh <- result
 	}
 }
 
 // processJob gets a io.Reader to the uploaded file from S3 and starts counting
-// the words. Returning the words counted or error.
-func (w *Worker) processJob(job *wordfreq.Job) (wordfreq.Words, error) {
-	result, err := w.s3Svc.GetObject(&s3.GetObjectInput{
+// the words. The top words counted are set on the result, and if enabled the
+// full histogram of words is written to S3, and the words are added to the
+// aggregate word counts, and the keywords scored. Returning error if one
+// occurred.
+// Errors returned are wordfreq.JobErrors so the job can be retried or failed
+// permanently.
+func (w *Worker) processJob(result *wordfreq.JobResult) error {
+	job := result.Job
+
+	// The settings are loaded once, so the whole job is processed with the
+	// same settings even if they are replaced.
+	settings := w.settings.Load().(jobSettings)
+
+	// Options not set by the job use the worker's configured options, then
+	// the defaults, and the effective options are included with the job's
+	// result.
+	job.Options = job.Options.WithDefaultsFrom(settings.options)
+	if err := job.Options.Validate(); err != nil {
+		// A job's word length can conflict with the worker's configured
+		// length it did not set.
+		return wordfreq.NewJobError(wordfreq.ErrInvalidJob, err)
+	}
+
+	// Objects must be read using a client for the region of their bucket.
+	s3Svc, err := w.s3Clients.ForJob(job)
+	if err != nil {
+		return classifyS3Error(err)
+	}
+
+	// The object's metadata is read before its content, so the result of a
+	// job which fails to get the object can still be sent to the uploader.
+	head, err := s3Svc.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(job.Bucket),
 		Key:    aws.String(job.Key),
 	})
 	if err != nil {
-		return nil, err
+		return classifyS3Error(err)
+	}
+	etag := aws.StringValue(head.ETag)
+	if job.ETag == "" {
+		// Jobs requested directly do not include the object's ETag.
+		job.ETag = strings.Trim(etag, `"`)
+	}
+	// Uploaders can tag the object with a correlation ID, and the queue the
+	// result should be sent to, so they can receive their results directly.
+	if job.CorrelationID == "" {
+		job.CorrelationID = metadataValue(head.Metadata, wordfreq.CorrelationIDMetadata)
+	}
+	if job.ReplyTo == "" {
+		job.ReplyTo = metadataValue(head.Metadata, wordfreq.ReplyToMetadata)
+	}
+
+	// The content must be the same object the metadata was read from. If
+	// the object is replaced in between the job fails, and is retried.
+	object, err := s3Svc.GetObject(&s3.GetObjectInput{
+		Bucket:  aws.String(job.Bucket),
+		Key:     aws.String(job.Key),
+		IfMatch: aws.String(etag),
+	})
+	if err != nil {
+		return classifyS3Error(err)
 	}
-	defer result.Body.Close()
+	defer object.Body.Close()
 
-	return w.countTopWords(result.Body, 10, job)
-}
+	result.ObjectSize = aws.Int64Value(object.ContentLength)
+	result.ContentType = aws.StringValue(object.ContentType)
 
-// countTopWords counts the top words returning those words or error.
-func (w *Worker) countTopWords(reader io.Reader, top int, job *wordfreq.Job) ([]wordfreq.Word, error) {
-	wordMap, err := w.countWords(reader, job)
+	// Transcode the object's content to UTF-8, using the job's charset, or
+	// the charset of the object's content type if the job does not set one,
+	// and it is supported. NewTextReader sniffs the content to make sure it
+	// is text before counting, since binary content would never produce
+	// meaningful words.
+	charset := job.Options.Charset
+	if charset == "" {
+		charset = wordfreq.CharsetFromContentType(result.ContentType)
+	}
+	reader, charset, err := wordfreq.NewTextReader(object.Body, charset)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	result.Charset = charset
 
-	words := collectTopWords(wordMap, top)
+	// Counts exceeding the worker's memory budget are spilled to disk, and
+	// removed once the job is processed.
+	counter := settings.counter
+	counter.Progress = func() error {
+		return w.extendVisibility(job)
+	}
+	counts, err := counter.Count(reader, job.Options)
+	if err != nil {
+		return err
+	}
+	defer counts.Close()
+	result.Language = counts.Language
+	result.LanguageConfidence = counts.LanguageConfidence
+	result.SkippedWords = counts.SkippedWords
+	result.TruncatedWords = counts.TruncatedWords
+	result.VocabularySize = counts.Vocabulary
+	result.TotalWords = counts.Total
 
-	return words, nil
-}
+	if w.histograms != nil {
+		histogram, err := w.histograms.Write(job, counts)
+		if err != nil {
+			return wordfreq.NewJobError(wordfreq.ErrTransient,
+				fmt.Errorf("failed to write histogram, %v", err))
+		}
+		result.Histogram = histogram
+	}
 
-// countWords collects the counts of all words received from an io.Reader. Using
-// a word scanner unique words are counted. This is a fairly simplistic implementation
-// of word counting and only splits words based on whitespace. Extra characters
-// such as `.,"'?!` are trimmed from the front and end of each string
-func (w *Worker) countWords(reader io.Reader, job *wordfreq.Job) (map[string]int, error) {
-	wordMap := map[string]int{}
-
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanWords)
-	for scanner.Scan() {
-		word := strings.ToLower(scanner.Text())
-		if len(word) <= 4 {
-			continue
+	// Aggregates are added before the result is recorded. If adding the
+	// aggregates fails the job will be retried, and chunks of words already
+	// added will not be added again.
+	if w.aggregates != nil {
+		if err := w.aggregates.Record(job, counts); err != nil {
+			return wordfreq.NewJobError(wordfreq.ErrTransient, err)
 		}
-		word = strings.Trim(word, `.,"'?!`)
 
-		curCount := 0
-		if v, ok := wordMap[word]; ok {
-			curCount = v
+		// Keywords are scored after the words are recorded, so the object
+		// is included in its scope's document frequencies.
+		keywords, err := w.aggregates.Keywords(job, counts)
+		if err != nil {
+			return wordfreq.NewJobError(wordfreq.ErrTransient, err)
 		}
+		result.Keywords = keywords
+	}
 
-		wordMap[word] = 1 + curCount
+	result.Words = counts.Top
 
-		// To make sure another worker doesn't grab long running processes
-		// bump up the job message's visibility timeout in the Queue.
-		if time.Now().Sub(job.StartedAt) > time.Duration(job.VisibilityTimeout/2)*time.Second {
-			timeAdded, err := w.queue.UpdateMessageVisibility(job.OrigMessage.ReceiptHandle)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to update job messages's visibility timeout, %v", err)
-			}
-			job.VisibilityTimeout += timeAdded
+	return nil
+}
 
+// metadataValue returns the value of the S3 object's user metadata with the
+// name provided. Metadata names are matched case insensitively since S3 returns
+// them in canonical header form.
+func metadataValue(metadata map[string]*string, name string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, name) {
+			return aws.StringValue(v)
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to count words, %v", err)
-	}
-
-	return wordMap, nil
+	return ""
 }
 
-// collectTopWords converts the word map into an array, and sorts it. Collecting
-// the top words.
-func collectTopWords(wordMap map[string]int, top int) wordfreq.Words {
-	words := wordfreq.Words{}
-	for word, count := range wordMap {
-		words = append(words, wordfreq.Word{Word: word, Count: count})
+// classifyS3Error converts the error returned by an Amazon S3 API operation
+// into a wordfreq.JobError. Errors for missing objects, or access denied will
+// not succeed if retried, where all other errors are considered transient.
+func classifyS3Error(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+			return wordfreq.NewJobError(wordfreq.ErrObjectMissing, err)
+		case "AccessDenied", "Forbidden":
+			return wordfreq.NewJobError(wordfreq.ErrAccessDenied, err)
+		case "EntityTooLarge":
+			return wordfreq.NewJobError(wordfreq.ErrTooLarge, err)
+		case s3.ErrCodeInvalidObjectState:
+			return wordfreq.NewJobError(wordfreq.ErrUnsupportedFormat, err)
+		}
 	}
-	sort.Sort(words)
+	return wordfreq.NewJobError(wordfreq.ErrTransient, err)
+}
 
-	if top >= len(words) {
-		return words
+// extendVisibility makes sure another worker doesn't grab long running
+// processes by bumping up the job message's visibility timeout in the Queue
+// once half of the timeout has elapsed since the message was received.
+func (w *Worker) extendVisibility(job *wordfreq.Job) error {
+	if time.Now().Sub(job.ReceivedAt) <= time.Duration(job.VisibilityTimeout/2)*time.Second {
+		return nil
+	}
+	timeAdded, err := w.queue.UpdateMessageVisibility(job.OrigMessage.ReceiptHandle)
+	if err != nil {
+		return wordfreq.NewJobError(wordfreq.ErrTransient,
+			fmt.Errorf("Failed to update job messages's visibility timeout, %v", err))
 	}
-	return words[:top]
+	job.VisibilityTimeout += timeAdded
+	return nil
 }
@@ -0,0 +1,117 @@
+package wordfreq
+
+import (
+	"math"
+	"sort"
+)
+
+// A Comparison is the difference in vocabulary between two sets of words, such
+// as the results of two versions of a document.
+//
+// Results only include the top words counted, so a word lost may have only
+// fallen out of the top words instead of being removed from the document.
+type Comparison struct {
+	// Words only in the second set of words, with their count in that set.
+	Gained Words
+	// Words only in the first set of words, with their count in that set.
+	Lost Words
+	// Words in both sets of words whose rank or count changed.
+	Changed []WordChange
+
+	// Cosine similarity of the word counts, from 0 with no words in common,
+	// to 1 for identical proportions of words.
+	Cosine float64
+	// Jaccard similarity of the words, the number of words in both sets
+	// divided by the number of words in either set.
+	Jaccard float64
+}
+
+// A WordChange is the change in rank and count of a word in both sets of words
+// compared. Ranks start at 1 for the most common word.
+type WordChange struct {
+	Word      string
+	FromRank  int
+	ToRank    int
+	FromCount int
+	ToCount   int
+}
+
+// RankDelta returns the number of ranks the word moved. Positive if the word
+// became more common.
+func (c WordChange) RankDelta() int {
+	return c.FromRank - c.ToRank
+}
+
+// CompareWords compares the from and to sets of words, returning the words
+// gained, lost, and changed, along with the similarity of the two sets. Words
+// are ranked by count, with words of equal count ranked alphabetically, so the
+// comparison is repeatable. Gained and lost words are sorted the same way,
+// and changed words are sorted by their rank in the to set.
+func CompareWords(from, to Words) Comparison {
+	fromCounts, toCounts := wordCounts(from), wordCounts(to)
+	fromRanks, toRanks := wordRanks(fromCounts), wordRanks(toCounts)
+
+	c := Comparison{Gained: Words{}, Lost: Words{}, Changed: []WordChange{}}
+	var dot, fromNorm, toNorm float64
+	common := 0
+
+	for _, word := range NewWords(fromCounts) {
+		fromNorm += float64(word.Count) * float64(word.Count)
+
+		toCount, ok := toCounts[word.Word]
+		if !ok {
+			c.Lost = append(c.Lost, word)
+			continue
+		}
+		common++
+		dot += float64(word.Count) * float64(toCount)
+
+		change := WordChange{
+			Word:      word.Word,
+			FromRank:  fromRanks[word.Word],
+			ToRank:    toRanks[word.Word],
+			FromCount: word.Count,
+			ToCount:   toCount,
+		}
+		if change.FromRank != change.ToRank || change.FromCount != change.ToCount {
+			c.Changed = append(c.Changed, change)
+		}
+	}
+	for _, word := range NewWords(toCounts) {
+		toNorm += float64(word.Count) * float64(word.Count)
+		if _, ok := fromCounts[word.Word]; !ok {
+			c.Gained = append(c.Gained, word)
+		}
+	}
+	sort.Slice(c.Changed, func(i, j int) bool {
+		return c.Changed[i].ToRank < c.Changed[j].ToRank
+	})
+
+	if fromNorm > 0 && toNorm > 0 {
+		c.Cosine = dot / (math.Sqrt(fromNorm) * math.Sqrt(toNorm))
+	}
+	if union := len(fromCounts) + len(toCounts) - common; union > 0 {
+		c.Jaccard = float64(common) / float64(union)
+	}
+
+	return c
+}
+
+// wordRanks returns the rank of each word in the word counts.
+func wordRanks(counts map[string]int) map[string]int {
+	ranks := make(map[string]int, len(counts))
+	for i, word := range NewWords(counts) {
+		ranks[word.Word] = i + 1
+	}
+	return ranks
+}
+
+// wordCounts converts the words into a map of word counts. Duplicate words are
+// combined.
+func wordCounts(words Words) map[string]int {
+	counts := make(map[string]int, len(words))
+	for _, word := range words {
+		counts[word.Word] += word.Count
+	}
+	return counts
+}
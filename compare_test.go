@@ -0,0 +1,140 @@
+package wordfreq
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCompareWords(t *testing.T) {
+	cases := []struct {
+		name          string
+		from, to      Words
+		expectGained  Words
+		expectLost    Words
+		expectChanged []WordChange
+		expectCosine  float64
+		expectJaccard float64
+	}{
+		{
+			name:         "gained lost and changed",
+			from:         Words{{Word: "alpha", Count: 3}, {Word: "beta", Count: 2}, {Word: "gamma", Count: 1}},
+			to:           Words{{Word: "beta", Count: 4}, {Word: "alpha", Count: 3}, {Word: "delta", Count: 1}},
+			expectGained: Words{{Word: "delta", Count: 1}},
+			expectLost:   Words{{Word: "gamma", Count: 1}},
+			expectChanged: []WordChange{
+				{Word: "beta", FromRank: 2, ToRank: 1, FromCount: 2, ToCount: 4},
+				{Word: "alpha", FromRank: 1, ToRank: 2, FromCount: 3, ToCount: 3},
+			},
+			expectCosine:  17 / math.Sqrt(14*26),
+			expectJaccard: 0.5,
+		},
+		{
+			name:         "count changed same rank",
+			from:         Words{{Word: "alpha", Count: 5}, {Word: "beta", Count: 1}},
+			to:           Words{{Word: "alpha", Count: 9}, {Word: "beta", Count: 1}},
+			expectGained: Words{},
+			expectLost:   Words{},
+			expectChanged: []WordChange{
+				{Word: "alpha", FromRank: 1, ToRank: 1, FromCount: 5, ToCount: 9},
+			},
+			expectCosine:  46 / math.Sqrt(26*82),
+			expectJaccard: 1,
+		},
+		{
+			name:          "ties ranked alphabetically",
+			from:          Words{{Word: "beta", Count: 2}, {Word: "alpha", Count: 2}},
+			to:            Words{{Word: "alpha", Count: 2}, {Word: "beta", Count: 2}},
+			expectGained:  Words{},
+			expectLost:    Words{},
+			expectChanged: []WordChange{},
+			expectCosine:  1,
+			expectJaccard: 1,
+		},
+		{
+			name:         "tie broken",
+			from:         Words{{Word: "alpha", Count: 2}, {Word: "beta", Count: 2}},
+			to:           Words{{Word: "alpha", Count: 2}, {Word: "beta", Count: 3}, {Word: "zeta", Count: 2}, {Word: "eta", Count: 2}},
+			expectGained: Words{{Word: "eta", Count: 2}, {Word: "zeta", Count: 2}},
+			expectLost:   Words{},
+			expectChanged: []WordChange{
+				{Word: "beta", FromRank: 2, ToRank: 1, FromCount: 2, ToCount: 3},
+				{Word: "alpha", FromRank: 1, ToRank: 2, FromCount: 2, ToCount: 2},
+			},
+			expectCosine:  10 / math.Sqrt(8*21),
+			expectJaccard: 0.5,
+		},
+		{
+			name:          "identical",
+			from:          Words{{Word: "alpha", Count: 7}, {Word: "beta", Count: 3}, {Word: "gamma", Count: 1}},
+			to:            Words{{Word: "alpha", Count: 7}, {Word: "beta", Count: 3}, {Word: "gamma", Count: 1}},
+			expectGained:  Words{},
+			expectLost:    Words{},
+			expectChanged: []WordChange{},
+			expectCosine:  1,
+			expectJaccard: 1,
+		},
+		{
+			name:          "duplicates combined",
+			from:          Words{{Word: "alpha", Count: 1}, {Word: "alpha", Count: 2}},
+			to:            Words{{Word: "alpha", Count: 3}},
+			expectGained:  Words{},
+			expectLost:    Words{},
+			expectChanged: []WordChange{},
+			expectCosine:  1,
+			expectJaccard: 1,
+		},
+		{
+			name:          "empty from",
+			from:          Words{},
+			to:            Words{{Word: "alpha", Count: 2}},
+			expectGained:  Words{{Word: "alpha", Count: 2}},
+			expectLost:    Words{},
+			expectChanged: []WordChange{},
+		},
+		{
+			name:          "empty to",
+			from:          Words{{Word: "alpha", Count: 2}},
+			to:            nil,
+			expectGained:  Words{},
+			expectLost:    Words{{Word: "alpha", Count: 2}},
+			expectChanged: []WordChange{},
+		},
+		{
+			name:          "both empty",
+			expectGained:  Words{},
+			expectLost:    Words{},
+			expectChanged: []WordChange{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			comparison := CompareWords(c.from, c.to)
+			if e, a := c.expectGained, comparison.Gained; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect gained %v, got %v", e, a)
+			}
+			if e, a := c.expectLost, comparison.Lost; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect lost %v, got %v", e, a)
+			}
+			if e, a := c.expectChanged, comparison.Changed; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect changed %v, got %v", e, a)
+			}
+			if e, a := c.expectCosine, comparison.Cosine; math.Abs(e-a) > 1e-9 {
+				t.Errorf("expect cosine %v, got %v", e, a)
+			}
+			if e, a := c.expectJaccard, comparison.Jaccard; math.Abs(e-a) > 1e-9 {
+				t.Errorf("expect jaccard %v, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestWordChangeRankDelta(t *testing.T) {
+	if e, a := 3, (WordChange{FromRank: 5, ToRank: 2}).RankDelta(); e != a {
+		t.Errorf("expect %d rank delta, got %d", e, a)
+	}
+	if e, a := -1, (WordChange{FromRank: 1, ToRank: 2}).RankDelta(); e != a {
+		t.Errorf("expect %d rank delta, got %d", e, a)
+	}
+}
@@ -0,0 +1,171 @@
+package wordfreq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is the number of bytes of content inspected to determine if the
+// content is text.
+const sniffLen = 512
+
+// CheckTextContent sniffs the start of the content to make sure it is text
+// before counting. Binary content would never produce meaningful words. The
+// reader is not advanced, so it can be passed on to CountWords.
+func CheckTextContent(reader *bufio.Reader) error {
+	head, err := reader.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return NewJobError(ErrTransient, err)
+	}
+	if contentType := http.DetectContentType(head); !strings.HasPrefix(contentType, "text/") {
+		return NewJobError(ErrUnsupportedFormat,
+			fmt.Errorf("unsupported content type %s", contentType))
+	}
+	return nil
+}
+
+// A WordCounter counts the words of documents within a memory budget. Once
+// the approximate memory used by the word counts exceeds the budget, the counts
+// are sorted by word and spilled to a temporary file, and counting continues
+// with empty counts. When counting completes the spilled counts are merged
+// with an external k-way merge, so the counts, and top words, are exact.
+type WordCounter struct {
+	// Approximate number of bytes the word counts may use before they are
+	// spilled to disk. Zero for no limit.
+	MemoryBudget int64
+	// Directory spilled counts are written to. Defaults to the system's
+	// temporary directory.
+	TempDir string
+	// Optional, called after each word is counted, and after each word is
+	// merged. If it returns an error counting stops and the error is returned.
+	Progress func() error
+}
+
+// CountWords counts the words received from an io.Reader with a WordCounter
+// without a memory budget, and the progress function provided.
+func CountWords(reader io.Reader, opts AnalysisOptions, progress func() error) (*WordCounts, error) {
+	return WordCounter{Progress: progress}.Count(reader, opts)
+}
+
+// Count collects the counts of all words received from an io.Reader. Using
+// a word tokenizer unique words are counted. This is a fairly simplistic implementation
+// of word counting and only splits words based on whitespace. Extra characters
+// such as `.,"'?!` are trimmed from the front and end of each string.
+//
+// Words are not limited in length by the tokenizer. Words longer than the
+// options' MaxWordLength are skipped or truncated by the LongWordPolicy, and
+// the number of words skipped and truncated are included in the counts.
+//
+// If the options do not set the language, the language is detected from a
+// prefix of the content. The language's settings select additional characters
+// which are trimmed, and stopwords which are not counted. The top words are
+// collected by the options' Top, or all words if it is zero.
+//
+// The counts must be closed when no longer needed to remove any spilled counts.
+// Errors returned are JobErrors.
+func (c WordCounter) Count(reader io.Reader, opts AnalysisOptions) (*WordCounts, error) {
+	top := opts.Top
+	opts = opts.WithDefaults()
+	bufReader := bufio.NewReaderSize(reader, languageDetectLen)
+
+	language, confidence := opts.Language, 1.0
+	if language == "" {
+		var err error
+		language, confidence, err = detectReaderLanguage(bufReader)
+		if err != nil {
+			return nil, NewJobError(ErrTransient, err)
+		}
+	}
+	settings := GetLanguageSettings(language)
+	trimChars := wordTrimChars + settings.TrimChars
+
+	acc := newSpillAccumulator(c)
+	tokenizer := newWordTokenizer(bufReader, opts.MaxWordLength, opts.LongWordPolicy)
+	for {
+		word, ok, err := tokenizer.next()
+		if err != nil {
+			acc.remove()
+			return nil, NewJobError(ErrTransient, fmt.Errorf("failed to count words, %v", err))
+		}
+		if !ok {
+			break
+		}
+
+		word = strings.ToLower(word)
+		if len(word) < opts.MinWordLength {
+			continue
+		}
+		word = strings.Trim(word, trimChars)
+		if settings.Stopwords[word] {
+			continue
+		}
+
+		if err := acc.add(word, 1); err != nil {
+			acc.remove()
+			return nil, countError(err)
+		}
+	}
+
+	counts, err := acc.finish(top)
+	if err != nil {
+		return nil, countError(err)
+	}
+	counts.Language, counts.LanguageConfidence = language, confidence
+	counts.SkippedWords, counts.TruncatedWords = tokenizer.skipped, tokenizer.truncated
+	return counts, nil
+}
+
+// Merge combines the counts of words into a single set of counts, within the
+// counter's memory budget, and collects the top words of the combined counts.
+// A top of zero collects all words. The counts merged are not closed.
+func (c WordCounter) Merge(top int, counts ...*WordCounts) (*WordCounts, error) {
+	acc := newSpillAccumulator(c)
+	var skipped, truncated int
+	for _, wc := range counts {
+		if err := wc.Each(acc.add); err != nil {
+			acc.remove()
+			return nil, countError(err)
+		}
+		skipped += wc.SkippedWords
+		truncated += wc.TruncatedWords
+	}
+
+	merged, err := acc.finish(top)
+	if err != nil {
+		return nil, countError(err)
+	}
+	merged.SkippedWords, merged.TruncatedWords = skipped, truncated
+	return merged, nil
+}
+
+// countError converts the error into a JobError, if it is not already one.
+// Errors which are not JobErrors are transient.
+func countError(err error) error {
+	if _, ok := err.(*JobError); ok {
+		return err
+	}
+	return NewJobError(ErrTransient, err)
+}
+
+// TotalWords returns the total number of words counted in the word map.
+func TotalWords(wordMap map[string]int) int {
+	total := 0
+	for _, count := range wordMap {
+		total += count
+	}
+	return total
+}
+
+// TopWords converts the word map into an array, and sorts it. Collecting the
+// top words. Words with equal counts are sorted alphabetically. If top is
+// zero or larger than the number of words, all words are returned.
+func TopWords(wordMap map[string]int, top int) Words {
+	words := NewWords(wordMap)
+	if top <= 0 || top >= len(words) {
+		return words
+	}
+	return words[:top]
+}
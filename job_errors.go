@@ -0,0 +1,67 @@
+package wordfreq
+
+import "fmt"
+
+// A JobErrorCode identifies the class of failure a job encountered. The code
+// is included in the job result so consumers of the result queue can tell
+// failures apart without parsing the status message.
+type JobErrorCode string
+
+const (
+	// ErrObjectMissing the object or its bucket no longer exist.
+	ErrObjectMissing JobErrorCode = "ObjectMissing"
+	// ErrAccessDenied the worker is not allowed to read the object.
+	ErrAccessDenied JobErrorCode = "AccessDenied"
+	// ErrTooLarge the object, or a part of it, is too large to be processed.
+	ErrTooLarge JobErrorCode = "TooLarge"
+	// ErrUnsupportedFormat the object's content is not text the worker can count.
+	ErrUnsupportedFormat JobErrorCode = "UnsupportedFormat"
+	// ErrInvalidJob the job message is an unsupported version, or has invalid
+	// options.
+	ErrInvalidJob JobErrorCode = "InvalidJob"
+	// ErrTransient a temporary failure such as a network error, throttling, or
+	// service error. Jobs failing with this code may succeed if retried.
+	ErrTransient JobErrorCode = "Transient"
+)
+
+// Retryable returns if a job which failed with this code could succeed if
+// it were retried.
+func (c JobErrorCode) Retryable() bool {
+	switch c {
+	case ErrObjectMissing, ErrAccessDenied, ErrTooLarge, ErrUnsupportedFormat, ErrInvalidJob:
+		return false
+	default:
+		return true
+	}
+}
+
+// A JobError is an error which occurred while processing a job, classified by
+// a JobErrorCode.
+type JobError struct {
+	Code JobErrorCode
+	Err  error
+}
+
+// NewJobError wraps the error with the JobErrorCode provided.
+func NewJobError(code JobErrorCode, err error) *JobError {
+	return &JobError{Code: code, Err: err}
+}
+
+// Error returns the string representation of the error, prefixed by its code.
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+// Retryable returns if the job could succeed if it were retried.
+func (e *JobError) Retryable() bool {
+	return e.Code.Retryable()
+}
+
+// GetJobErrorCode returns the JobErrorCode of the error. Errors which are not
+// a JobError are considered transient, since the cause is unknown.
+func GetJobErrorCode(err error) JobErrorCode {
+	if jobErr, ok := err.(*JobError); ok {
+		return jobErr.Code
+	}
+	return ErrTransient
+}
@@ -0,0 +1,161 @@
+package wordfreq
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// JobRequestVersion is the current version of the JobRequest message format.
+const JobRequestVersion = "1"
+
+// A JobRequest is the native job message format. In addition to the S3 event
+// notifications, a JobRequest can be sent to the job queue directly to count
+// the words of an object with options other than the defaults. A message is
+// identified as a JobRequest by its JobVersion field.
+type JobRequest struct {
+	JobVersion string
+
+	// Location of the object to count the words of.
+	Region, Bucket, Key string
+
+	// Options the words will be counted with. Zero values use the defaults.
+	Options AnalysisOptions
+
+	// Caller supplied ID which is included in the job's result so the caller
+	// can match the result to its request.
+	CorrelationID string `json:",omitempty"`
+	// SQS queue URL the job's result will be sent to instead of the worker's
+	// result queue.
+	ReplyTo string `json:",omitempty"`
+}
+
+// Validate returns an error if the job request is not a supported version or
+// is missing required fields.
+func (r JobRequest) Validate() error {
+	if r.JobVersion != JobRequestVersion {
+		return fmt.Errorf("unsupported job request version %q, expected %q",
+			r.JobVersion, JobRequestVersion)
+	}
+	if r.Bucket == "" || r.Key == "" {
+		return fmt.Errorf("job request missing bucket or key")
+	}
+	return r.Options.Validate()
+}
+
+const (
+	// DefaultTop is the default number of top words collected.
+	DefaultTop = 10
+	// DefaultMinWordLength is the default minimum length of a word counted.
+	DefaultMinWordLength = 5
+	// DefaultMaxWordLength is the default maximum length in bytes of a word
+	// counted, the same as the longest word aggregate counts are recorded for.
+	DefaultMaxWordLength = 1024
+)
+
+// Policies for words longer than the maximum word length.
+const (
+	// LongWordSkip skips long words, they are not counted.
+	LongWordSkip = "skip"
+	// LongWordTruncate truncates long words to the maximum word length, and
+	// counts the truncated word.
+	LongWordTruncate = "truncate"
+)
+
+// AnalysisOptions are the options a job's words are counted with.
+type AnalysisOptions struct {
+	// Number of most common words collected. Defaults to DefaultTop.
+	Top int `json:",omitempty"`
+	// Words shorter than this are not counted. Defaults to DefaultMinWordLength.
+	MinWordLength int `json:",omitempty"`
+	// Language of the document, which selects the language dependent settings
+	// words are counted with. Detected from the document if not set.
+	Language string `json:",omitempty"`
+	// Character encoding of the document, which is transcoded to UTF-8
+	// before counting. Taken from the object's Content-Type, or detected from
+	// the document, if not set.
+	Charset string `json:",omitempty"`
+	// Words longer than this many bytes, such as base64 blobs or minified
+	// content, are handled by the LongWordPolicy. Defaults to
+	// DefaultMaxWordLength.
+	MaxWordLength int `json:",omitempty"`
+	// Policy for words longer than MaxWordLength, LongWordSkip or
+	// LongWordTruncate. Defaults to LongWordSkip.
+	LongWordPolicy string `json:",omitempty"`
+}
+
+// WithDefaults returns a copy of the options with the defaults set for all
+// options which were not set.
+func (o AnalysisOptions) WithDefaults() AnalysisOptions {
+	if o.Top == 0 {
+		o.Top = DefaultTop
+	}
+	if o.MinWordLength == 0 {
+		o.MinWordLength = DefaultMinWordLength
+	}
+	if o.MaxWordLength == 0 {
+		o.MaxWordLength = DefaultMaxWordLength
+	}
+	if o.LongWordPolicy == "" {
+		o.LongWordPolicy = LongWordSkip
+	}
+	return o
+}
+
+// WithDefaultsFrom returns a copy of the options with the options which were
+// not set taken from the defaults provided, and any still not set from the
+// package defaults.
+func (o AnalysisOptions) WithDefaultsFrom(defaults AnalysisOptions) AnalysisOptions {
+	if o.Top == 0 {
+		o.Top = defaults.Top
+	}
+	if o.MinWordLength == 0 {
+		o.MinWordLength = defaults.MinWordLength
+	}
+	if o.Language == "" {
+		o.Language = defaults.Language
+	}
+	if o.Charset == "" {
+		o.Charset = defaults.Charset
+	}
+	if o.MaxWordLength == 0 {
+		o.MaxWordLength = defaults.MaxWordLength
+	}
+	if o.LongWordPolicy == "" {
+		o.LongWordPolicy = defaults.LongWordPolicy
+	}
+	return o.WithDefaults()
+}
+
+// Validate returns an error if any of the options are invalid. Word lengths
+// are only compared if both are set, so options which take one of them from
+// the defaults must be validated again once the defaults are set.
+func (o AnalysisOptions) Validate() error {
+	if o.Top < 0 {
+		return fmt.Errorf("invalid top words %d", o.Top)
+	}
+	if o.MinWordLength < 0 {
+		return fmt.Errorf("invalid min word length %d", o.MinWordLength)
+	}
+	if o.MaxWordLength < 0 || (o.MaxWordLength > 0 && o.MaxWordLength < utf8.UTFMax) {
+		// Long words are truncated on a character boundary, so the maximum
+		// length must fit the longest character.
+		return fmt.Errorf("invalid max word length %d, must be at least %d",
+			o.MaxWordLength, utf8.UTFMax)
+	}
+	if o.MinWordLength > 0 && o.MaxWordLength > 0 && o.MaxWordLength < o.MinWordLength {
+		return fmt.Errorf("max word length %d less than min word length %d",
+			o.MaxWordLength, o.MinWordLength)
+	}
+	switch o.LongWordPolicy {
+	case "", LongWordSkip, LongWordTruncate:
+	default:
+		return fmt.Errorf("invalid long word policy %s", o.LongWordPolicy)
+	}
+	if err := validateLanguage(o.Language); err != nil {
+		return err
+	}
+	if _, ok := NormalizeCharset(o.Charset); o.Charset != "" && !ok {
+		return fmt.Errorf("unsupported charset %s", o.Charset)
+	}
+	return nil
+}
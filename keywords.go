@@ -0,0 +1,238 @@
+package wordfreq
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// AggregateDocumentsAttr is the attribute of the aggregate word count table
+// with the number of documents in the scope which contain the word.
+const AggregateDocumentsAttr = "Documents"
+
+// AggregateDocumentsWord is the word of the aggregate table item with the
+// total number of documents in the scope. Words never contain whitespace, so
+// this can not be the same as a word counted.
+const AggregateDocumentsWord = " documents"
+
+// maxBatchGetKeys is the maximum number of keys in a DynamoDB BatchGetItem
+// request.
+const maxBatchGetKeys = 100
+
+const (
+	// unprocessedBaseDelay, and unprocessedMaxDelay are the bounds of the
+	// exponential backoff between requests for unprocessed keys.
+	unprocessedBaseDelay = 50 * time.Millisecond
+	unprocessedMaxDelay  = 5 * time.Second
+	// maxUnprocessedRetries is the number of times unprocessed keys are
+	// requested again before giving up.
+	maxUnprocessedRetries = 10
+)
+
+// A Keyword is a word which is distinctive to a document compared to the
+// other documents of its corpus, scored by TF-IDF.
+type Keyword struct {
+	Word  string
+	Count int
+	// TF-IDF score of the word. The word's frequency in the document,
+	// weighted by the inverse of the number of documents containing it.
+	Score float64
+}
+
+type Keywords []Keyword
+
+// DocumentFrequencies are the number of documents in a corpus scope, and the
+// number of those documents each word occurs in.
+type DocumentFrequencies struct {
+	Documents int
+	Words     map[string]int
+}
+
+// TFIDFKeywords scores each word counted in a document by TF-IDF with the
+// document frequencies of the document's corpus, and returns the top highest
+// scoring keywords. Keywords with equal scores are sorted alphabetically. A
+// top of zero or less returns all keywords.
+func TFIDFKeywords(wordMap map[string]int, freqs DocumentFrequencies, top int) Keywords {
+	total := TotalWords(wordMap)
+	collector := NewKeywordCollector(top)
+	for word, count := range wordMap {
+		collector.Add(Keyword{Word: word, Count: count, Score: freqs.Score(count, total, word)})
+	}
+	return collector.Keywords()
+}
+
+// Score returns the TF-IDF score of a word counted in a document with the
+// total number of words provided.
+//
+// The inverse document frequency is smoothed, ln((1+N)/(1+df))+1, so words in
+// every document still have a small positive score, and words missing from
+// the document frequencies are treated as occurring only in this document.
+func (f DocumentFrequencies) Score(count, total int, word string) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	numDocs := f.Documents
+	if numDocs < 1 {
+		numDocs = 1
+	}
+	docs := f.Words[word]
+	if docs < 1 {
+		docs = 1
+	}
+
+	tf := float64(count) / float64(total)
+	idf := math.Log(float64(1+numDocs)/float64(1+docs)) + 1
+	return tf * idf
+}
+
+// A KeywordCollector collects the top highest scoring keywords added to it,
+// without holding all of the keywords in memory. If top is zero or less all
+// keywords are collected.
+type KeywordCollector struct {
+	top  int
+	heap keywordHeap
+}
+
+// NewKeywordCollector creates a KeywordCollector collecting the top keywords.
+func NewKeywordCollector(top int) *KeywordCollector {
+	return &KeywordCollector{top: top}
+}
+
+// Add adds the keyword, removing the lowest scoring keyword if there are more
+// than the top keywords.
+func (c *KeywordCollector) Add(keyword Keyword) {
+	heap.Push(&c.heap, keyword)
+	if c.top > 0 && len(c.heap) > c.top {
+		heap.Pop(&c.heap)
+	}
+}
+
+// Keywords returns the keywords collected sorted by score, with keywords of
+// equal score sorted alphabetically.
+func (c *KeywordCollector) Keywords() Keywords {
+	keywords := append(Keywords{}, c.heap...)
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Score != keywords[j].Score {
+			return keywords[i].Score > keywords[j].Score
+		}
+		return keywords[i].Word < keywords[j].Word
+	})
+	return keywords
+}
+
+// keywordHeap is a min heap of keywords ordered by the lowest score, with
+// keywords of equal score ordered reverse alphabetically.
+type keywordHeap []Keyword
+
+func (h keywordHeap) Len() int { return len(h) }
+func (h keywordHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	return h[i].Word > h[j].Word
+}
+func (h keywordHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keywordHeap) Push(x interface{}) { *h = append(*h, x.(Keyword)) }
+func (h *keywordHeap) Pop() interface{} {
+	old := *h
+	k := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return k
+}
+
+// QueryDocumentFrequencies gets the number of documents in the scope, and the
+// number of documents each of the words occurs in, from the aggregate table.
+// Words not found in the table are omitted from the frequencies.
+func QueryDocumentFrequencies(svc dynamodbiface.DynamoDBAPI, tableName, scope string, words []string) (DocumentFrequencies, error) {
+	freqs := DocumentFrequencies{Words: map[string]int{}}
+
+	words = append([]string{AggregateDocumentsWord}, words...)
+	for i := 0; i < len(words); i += maxBatchGetKeys {
+		end := i + maxBatchGetKeys
+		if end > len(words) {
+			end = len(words)
+		}
+
+		keys := make([]map[string]*dynamodb.AttributeValue, 0, end-i)
+		for _, word := range words[i:end] {
+			keys = append(keys, map[string]*dynamodb.AttributeValue{
+				AggregateScopeAttr: {S: aws.String(scope)},
+				AggregateWordAttr:  {S: aws.String(word)},
+			})
+		}
+
+		requests := map[string]*dynamodb.KeysAndAttributes{
+			tableName: {
+				Keys:                 keys,
+				ProjectionExpression: aws.String("#word, #documents"),
+				ExpressionAttributeNames: map[string]*string{
+					"#word":      aws.String(AggregateWordAttr),
+					"#documents": aws.String(AggregateDocumentsAttr),
+				},
+			},
+		}
+		// Keys not processed due to throttling, or the size of the
+		// response, are requested again until all have been processed,
+		// backing off so throttled requests are not retried immediately.
+		for retries := 0; len(requests) > 0; retries++ {
+			if retries > maxUnprocessedRetries {
+				return DocumentFrequencies{}, fmt.Errorf("keys still unprocessed after %d retries", maxUnprocessedRetries)
+			}
+			if retries > 0 {
+				time.Sleep(unprocessedDelay(retries))
+			}
+			resp, err := svc.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: requests})
+			if err != nil {
+				return DocumentFrequencies{}, err
+			}
+			for _, item := range resp.Responses[tableName] {
+				word, docs := item[AggregateWordAttr], item[AggregateDocumentsAttr]
+				if word == nil || docs == nil {
+					continue
+				}
+				n, err := strconv.Atoi(aws.StringValue(docs.N))
+				if err != nil {
+					return DocumentFrequencies{}, err
+				}
+				if w := aws.StringValue(word.S); w == AggregateDocumentsWord {
+					freqs.Documents = n
+				} else {
+					freqs.Words[w] = n
+				}
+			}
+			requests = resp.UnprocessedKeys
+		}
+	}
+
+	return freqs, nil
+}
+
+// unprocessedDelay returns the delay before unprocessed keys are requested
+// again, for the number of retries. The delay is random up to the retry's
+// maximum delay, full jitter, so concurrent workers throttled at the same time
+// do not retry at the same time.
+func unprocessedDelay(retries int) time.Duration {
+	return time.Duration(rand.Int63n(int64(unprocessedMaxRetryDelay(retries)) + 1))
+}
+
+// unprocessedMaxRetryDelay returns the maximum delay before unprocessed keys
+// are requested again, for the number of retries. The delay grows
+// exponentially from unprocessedBaseDelay up to unprocessedMaxDelay.
+func unprocessedMaxRetryDelay(retries int) time.Duration {
+	delay := unprocessedMaxDelay
+	if retries < 16 {
+		if d := unprocessedBaseDelay << uint(retries-1); d < delay {
+			delay = d
+		}
+	}
+	return delay
+}
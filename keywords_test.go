@@ -0,0 +1,206 @@
+package wordfreq
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func TestDocumentFrequenciesScore(t *testing.T) {
+	corpus := DocumentFrequencies{
+		Documents: 10,
+		Words:     map[string]int{"common": 10, "rare": 1, "some": 4},
+	}
+
+	cases := []struct {
+		name         string
+		freqs        DocumentFrequencies
+		word         string
+		count, total int
+		expectScore  float64
+	}{
+		{name: "in every document", freqs: corpus, word: "common", count: 3, total: 10,
+			expectScore: 0.3},
+		{name: "in one document", freqs: corpus, word: "rare", count: 1, total: 10,
+			expectScore: 0.1 * (math.Log(11.0/2.0) + 1)},
+		{name: "in some documents", freqs: corpus, word: "some", count: 2, total: 10,
+			expectScore: 0.2 * (math.Log(11.0/5.0) + 1)},
+		{name: "missing from aggregates", freqs: corpus, word: "missing", count: 1, total: 10,
+			expectScore: 0.1 * (math.Log(11.0/2.0) + 1)},
+		{name: "zero document corpus", freqs: DocumentFrequencies{}, word: "word", count: 2, total: 8,
+			expectScore: 0.25},
+		{name: "no words", freqs: corpus, word: "common", count: 0, total: 0,
+			expectScore: 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			score := c.freqs.Score(c.count, c.total, c.word)
+			if e, a := c.expectScore, score; math.Abs(e-a) > 1e-9 {
+				t.Errorf("expect %v score, got %v", e, a)
+			}
+		})
+	}
+}
+
+func TestTFIDFKeywords(t *testing.T) {
+	freqs := DocumentFrequencies{
+		Documents: 10,
+		Words:     map[string]int{"common": 10, "rare": 1},
+	}
+	words := map[string]int{"common": 6, "rare": 2, "missing": 2}
+
+	keywords := TFIDFKeywords(words, freqs, 2)
+	expect := Keywords{
+		{Word: "common", Count: 6, Score: 0.6},
+		// Equal scores are sorted alphabetically.
+		{Word: "missing", Count: 2, Score: 0.2 * (math.Log(11.0/2.0) + 1)},
+	}
+	if e, a := len(expect), len(keywords); e != a {
+		t.Fatalf("expect %d keywords, got %d", e, a)
+	}
+	for i := range expect {
+		if e, a := expect[i].Word, keywords[i].Word; e != a {
+			t.Errorf("%d: expect %s word, got %s", i, e, a)
+		}
+		if e, a := expect[i].Count, keywords[i].Count; e != a {
+			t.Errorf("%d: expect %d count, got %d", i, e, a)
+		}
+		if e, a := expect[i].Score, keywords[i].Score; math.Abs(e-a) > 1e-9 {
+			t.Errorf("%d: expect %v score, got %v", i, e, a)
+		}
+	}
+
+	if e, a := 3, len(TFIDFKeywords(words, freqs, 0)); e != a {
+		t.Errorf("expect %d keywords with no top, got %d", e, a)
+	}
+	if e, a := 0, len(TFIDFKeywords(map[string]int{}, freqs, 2)); e != a {
+		t.Errorf("expect %d keywords of no words, got %d", e, a)
+	}
+}
+
+func TestKeywordCollector(t *testing.T) {
+	keywords := Keywords{
+		{Word: "d", Score: 0.1}, {Word: "a", Score: 0.5}, {Word: "c", Score: 0.3},
+		{Word: "b", Score: 0.3}, {Word: "e", Score: 0.9},
+	}
+
+	cases := []struct {
+		top    int
+		expect []string
+	}{
+		{top: 1, expect: []string{"e"}},
+		{top: 3, expect: []string{"e", "a", "b"}},
+		{top: 0, expect: []string{"e", "a", "b", "c", "d"}},
+		{top: 10, expect: []string{"e", "a", "b", "c", "d"}},
+	}
+
+	for _, c := range cases {
+		collector := NewKeywordCollector(c.top)
+		for _, keyword := range keywords {
+			collector.Add(keyword)
+		}
+		words := []string{}
+		for _, keyword := range collector.Keywords() {
+			words = append(words, keyword.Word)
+		}
+		if e, a := c.expect, words; !reflect.DeepEqual(e, a) {
+			t.Errorf("top %d: expect %v, got %v", c.top, e, a)
+		}
+	}
+}
+
+func TestUnprocessedDelay(t *testing.T) {
+	expect := []time.Duration{
+		50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond,
+		400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond,
+		3200 * time.Millisecond, 5 * time.Second, 5 * time.Second,
+	}
+	for i, e := range expect {
+		if a := unprocessedMaxRetryDelay(i + 1); e != a {
+			t.Errorf("retry %d: expect %v max delay, got %v", i+1, e, a)
+		}
+	}
+	// Retries far past the cap must not overflow the shifted delay.
+	for _, retries := range []int{16, 64, 1000} {
+		if e, a := unprocessedMaxDelay, unprocessedMaxRetryDelay(retries); e != a {
+			t.Errorf("retry %d: expect %v max delay, got %v", retries, e, a)
+		}
+	}
+
+	for retries := 1; retries <= maxUnprocessedRetries; retries++ {
+		max := unprocessedMaxRetryDelay(retries)
+		for i := 0; i < 100; i++ {
+			if d := unprocessedDelay(retries); d < 0 || d > max {
+				t.Fatalf("retry %d: expect delay from 0 to %v, got %v", retries, max, d)
+			}
+		}
+	}
+}
+
+// mockBatchGetDynamoDB returns the document frequencies of the words, leaving
+// keys unprocessed for the first number of requests.
+type mockBatchGetDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	docs        map[string]int
+	unprocessed int
+	requests    int
+}
+
+func (m *mockBatchGetDynamoDB) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	m.requests++
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	for table, keysAndAttrs := range input.RequestItems {
+		keys := keysAndAttrs.Keys
+		if m.unprocessed > 0 {
+			// Half of the keys are processed, the rest left for later.
+			m.unprocessed--
+			unprocessed := *keysAndAttrs
+			unprocessed.Keys = keys[len(keys)/2:]
+			output.UnprocessedKeys[table] = &unprocessed
+			keys = keys[:len(keys)/2]
+		}
+		for _, key := range keys {
+			word := aws.StringValue(key[AggregateWordAttr].S)
+			n, ok := m.docs[word]
+			if !ok {
+				continue
+			}
+			output.Responses[table] = append(output.Responses[table], map[string]*dynamodb.AttributeValue{
+				AggregateWordAttr:      {S: aws.String(word)},
+				AggregateDocumentsAttr: {N: aws.String(strconv.Itoa(n))},
+			})
+		}
+	}
+	return output, nil
+}
+
+func TestQueryDocumentFrequenciesUnprocessedKeys(t *testing.T) {
+	svc := &mockBatchGetDynamoDB{
+		docs:        map[string]int{AggregateDocumentsWord: 12, "alpha": 3, "beta": 7, "gamma": 1},
+		unprocessed: 2,
+	}
+
+	freqs, err := QueryDocumentFrequencies(svc, "table", "bucket/", []string{"alpha", "beta", "gamma", "delta"})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := 12, freqs.Documents; e != a {
+		t.Errorf("expect %d documents, got %d", e, a)
+	}
+	if e, a := map[string]int{"alpha": 3, "beta": 7, "gamma": 1}, freqs.Words; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v words, got %v", e, a)
+	}
+	if e, a := 3, svc.requests; e != a {
+		t.Errorf("expect %d requests, got %d", e, a)
+	}
+}
@@ -0,0 +1,266 @@
+package wordfreq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Languages which can be detected, and have language specific analysis
+// settings. Identified by their ISO 639-1 code.
+const (
+	LanguageEnglish    = "en"
+	LanguageSpanish    = "es"
+	LanguageFrench     = "fr"
+	LanguageGerman     = "de"
+	LanguageItalian    = "it"
+	LanguagePortuguese = "pt"
+	LanguageDutch      = "nl"
+)
+
+const (
+	// languageDetectLen is the length in bytes of the prefix of a document
+	// its language is detected from.
+	languageDetectLen = 4096
+	// languageProfileLen is the number of most common n-grams in the profile
+	// of a language, or document.
+	languageProfileLen = 300
+	// languageMinNGrams is the minimum number of n-grams a document's prefix
+	// must have for its language to be detected.
+	languageMinNGrams = 50
+	// languageMinConfidence is the minimum confidence of a detected language.
+	// Documents detected with less confidence have no language. Calibrated
+	// against prose of each language, which is detected with a confidence of
+	// at least 0.075 from 150 bytes, and source code, JSON, and base64 data,
+	// which are detected with no more than 0.054. Closely related languages,
+	// such as Spanish and Portuguese, can need a few hundred bytes.
+	languageMinConfidence = 0.065
+	// languageMinOverlap is the minimum fraction of a document's n-grams which
+	// must be in the profile of the detected language. Prose has an overlap
+	// of at least 0.5, where text which is not prose, such as code or random
+	// words, shares fewer n-grams with any language.
+	languageMinOverlap = 0.46
+)
+
+// wordTrimChars are the extra characters trimmed from the front and end of
+// each word counted, in all languages.
+const wordTrimChars = `.,"'?!`
+
+// LanguageSettings are the language dependent settings words are counted with.
+// Words are not stemmed, so the inflections of a word are counted as separate
+// words.
+type LanguageSettings struct {
+	// Extra characters trimmed from the front and end of each word, in
+	// addition to the characters trimmed for all languages.
+	TrimChars string
+	// Common words of the language which are not counted.
+	Stopwords map[string]bool
+}
+
+// languageSettings are the settings of each supported language. Documents
+// without a language are counted with the zero value settings. Stopwords are
+// all shorter than DefaultMinWordLength, so with the default options the
+// same words are counted as without stopwords, other than short words
+// wrapped in trimmed punctuation.
+var languageSettings = map[string]LanguageSettings{
+	LanguageEnglish: {
+		TrimChars: "“”‘’",
+		Stopwords: newStopwords(`a all also an and any are as at be been but by can do for from
+			had has have he her his how i if in into is it its just more not of on one only
+			or our out she so some than that the them then they this to was we were what
+			when who will with you your`),
+	},
+	LanguageSpanish: {
+		TrimChars: "¿¡«»“”",
+		Stopwords: newStopwords(`a al algo como con cual de del el ella en era es esta este
+			esto fue ha hay la las le les lo los mas me muy no nos o otra otro para pero por
+			que se sin su sus todo un una uno unos y ya`),
+	},
+	LanguageFrench: {
+		TrimChars: "«»“”’",
+		Stopwords: newStopwords(`à au aux avec ce ces dans de des du elle en est et il ils je
+			la le les leur mais ne nous on ou par pas pour qu que qui sa sans se ses son
+			sont sur tous tout un une vous`),
+	},
+	LanguageGerman: {
+		TrimChars: "„“”‚‘»«",
+		Stopwords: newStopwords(`aber alle als am an auch auf aus bei bis das dass dem den der
+			des die doch ein eine es für hat ich ihr im in ist mit nach noch nur oder sich
+			sie sind so um und uns von vor war was wenn wie wir wird zu zum zur`),
+	},
+	LanguageItalian: {
+		TrimChars: "«»“”’",
+		Stopwords: newStopwords(`a ad al alla che ci come con da dal dei del di e ed gli ha i
+			il in la le lo loro ma mi ne nel non o per più se sono su sua suo tra un una uno`),
+	},
+	LanguagePortuguese: {
+		TrimChars: "«»“”",
+		Stopwords: newStopwords(`a ao aos as com como da das de do dos e ela ele eles em era
+			essa esta este foi já mais mas na nas no nos não o os ou para pela pelo por que
+			se sem ser seu sua são tem um uma uns à`),
+	},
+	LanguageDutch: {
+		TrimChars: "„“”‘’",
+		Stopwords: newStopwords(`aan al als bij dat de deze die dit door een en er had heb het
+			hij hun ik in is je maar met na naar niet nog of om ook op over te tot uit van
+			voor was wat we werd wie wij zal ze zich zij zijn`),
+	},
+}
+
+// newStopwords creates a stopword set from the whitespace separated words.
+func newStopwords(words string) map[string]bool {
+	stopwords := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		stopwords[word] = true
+	}
+	return stopwords
+}
+
+// IsSupportedLanguage returns if the language can be detected, and has
+// language specific settings.
+func IsSupportedLanguage(language string) bool {
+	_, ok := languageSettings[language]
+	return ok
+}
+
+// GetLanguageSettings returns the settings words of the language are counted
+// with. Unsupported languages, or no language, have no language specific
+// settings.
+func GetLanguageSettings(language string) LanguageSettings {
+	return languageSettings[language]
+}
+
+// languageProfiles are the n-gram profiles of each supported language, built
+// from the language samples.
+var languageProfiles = func() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(languageSamples))
+	for language, sample := range languageSamples {
+		profiles[language] = newNGramProfile(sample)
+	}
+	return profiles
+}()
+
+// DetectLanguage detects the language of the text by comparing its n-gram
+// profile to the profile of each supported language, using the out-of-place
+// measure of Cavnar and Trenkle. The confidence is the relative distance
+// between the closest and next closest language, from 0 to 1. If the text is
+// too short, the confidence too low, or too few of its n-grams are in the
+// closest language's profile, an empty language is returned.
+func DetectLanguage(text string) (string, float64) {
+	profile := newNGramProfile(text)
+	if len(profile) < languageMinNGrams {
+		return "", 0
+	}
+
+	type distance struct {
+		language string
+		distance int
+		// Number of the text's n-grams in the language's profile.
+		matched int
+	}
+	distances := make([]distance, 0, len(languageProfiles))
+	for language, langProfile := range languageProfiles {
+		d, matched := 0, 0
+		for ngram, rank := range profile {
+			langRank, ok := langProfile[ngram]
+			if !ok {
+				d += languageProfileLen
+				continue
+			}
+			matched++
+			if rank > langRank {
+				d += rank - langRank
+			} else {
+				d += langRank - rank
+			}
+		}
+		distances = append(distances, distance{language, d, matched})
+	}
+	sort.Slice(distances, func(i, j int) bool {
+		if distances[i].distance != distances[j].distance {
+			return distances[i].distance < distances[j].distance
+		}
+		return distances[i].language < distances[j].language
+	})
+
+	best, next := distances[0], distances[1]
+	if next.distance == 0 {
+		return "", 0
+	}
+	confidence := float64(next.distance-best.distance) / float64(next.distance)
+	if confidence < languageMinConfidence {
+		return "", 0
+	}
+	if float64(best.matched)/float64(len(profile)) < languageMinOverlap {
+		return "", 0
+	}
+	return best.language, confidence
+}
+
+// detectReaderLanguage detects the language of the prefix of the reader's
+// content, without advancing the reader. The reader's buffer must be at least
+// languageDetectLen bytes.
+func detectReaderLanguage(reader *bufio.Reader) (string, float64, error) {
+	head, err := reader.Peek(languageDetectLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", 0, err
+	}
+
+	// Invalid UTF-8, such as a character split by the end of the prefix, is
+	// decoded as the replacement character, which is not a letter.
+	language, confidence := DetectLanguage(string(head))
+	return language, confidence, nil
+}
+
+// newNGramProfile returns the rank of the most common n-grams, of one to
+// three letters, of the words of the text. Words are padded with "_" so the
+// start and end of words are included in the n-grams.
+func newNGramProfile(text string) map[string]int {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		runes := []rune("_" + word + "_")
+		for n := 1; n <= 3; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				ngram := string(runes[i : i+n])
+				if ngram == "_" {
+					continue
+				}
+				counts[ngram]++
+			}
+		}
+	}
+
+	ngrams := make([]string, 0, len(counts))
+	for ngram := range counts {
+		ngrams = append(ngrams, ngram)
+	}
+	sort.Slice(ngrams, func(i, j int) bool {
+		if counts[ngrams[i]] != counts[ngrams[j]] {
+			return counts[ngrams[i]] > counts[ngrams[j]]
+		}
+		return ngrams[i] < ngrams[j]
+	})
+	if len(ngrams) > languageProfileLen {
+		ngrams = ngrams[:languageProfileLen]
+	}
+
+	profile := make(map[string]int, len(ngrams))
+	for i, ngram := range ngrams {
+		profile[ngram] = i
+	}
+	return profile
+}
+
+// validateLanguage returns an error if the language is set, and is not
+// supported.
+func validateLanguage(language string) error {
+	if language != "" && !IsSupportedLanguage(language) {
+		return fmt.Errorf("unsupported language %s", language)
+	}
+	return nil
+}
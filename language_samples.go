@@ -0,0 +1,143 @@
+package wordfreq
+
+// languageSamples are samples of text in each supported language. The
+// n-gram profile of each language used to detect the language of documents
+// is built from its sample. Each sample covers a few different topics, so the
+// profile is not biased to the words of one topic.
+var languageSamples = map[string]string{
+	LanguageEnglish: `All human beings are born free and equal in dignity and rights.
+They are endowed with reason and conscience and should act towards one another
+in a spirit of brotherhood. Everyone is entitled to all the rights and freedoms
+set forth in this declaration, without distinction of any kind, such as race,
+colour, sex, language, religion, political or other opinion, national or social
+origin, property, birth or other status. Everyone has the right to life, liberty
+and security of person. No one shall be held in slavery or servitude. The weather
+this morning was cold and grey, so we stayed inside with a pot of tea and read
+through the newspaper while the children played with their friends in the garden.
+Which of these would you rather have, the house near the river or the one that
+was built on the hill? There is nothing they could have done about it, because
+the train had already left the station when they arrived.
+On Saturdays the market in the old square is full of people buying vegetables,
+bread and cheese. My grandmother always said that the best tomatoes are sold by
+the farmers who arrive early, before the sun gets too hot. Last year the town
+decided to close the street to cars, and now children ride their bicycles where
+the buses used to pass. If you want to visit, take the small road along the lake
+and stop at the bakery next to the church, where they make the bread themselves.`,
+
+	LanguageSpanish: `Todos los seres humanos nacen libres e iguales en dignidad y derechos
+y, dotados como están de razón y conciencia, deben comportarse fraternalmente los
+unos con los otros. Toda persona tiene todos los derechos y libertades proclamados
+en esta declaración, sin distinción alguna de raza, color, sexo, idioma, religión,
+opinión política o de cualquier otra índole, origen nacional o social, posición
+económica, nacimiento o cualquier otra condición. Todo individuo tiene derecho a
+la vida, a la libertad y a la seguridad de su persona. Esta mañana hacía mucho frío,
+así que nos quedamos en casa tomando un café y leyendo el periódico mientras los
+niños jugaban con sus amigos en el jardín. ¿Cuál de estas casas prefieres, la que
+está cerca del río o la que construyeron sobre la colina? No pudieron hacer nada,
+porque el tren ya había salido de la estación cuando llegaron.
+Los sábados el mercado de la plaza vieja está lleno de gente que compra verduras,
+pan y queso. Mi abuela siempre decía que los mejores tomates los venden los
+agricultores que llegan temprano, antes de que el sol caliente demasiado. El año
+pasado el pueblo decidió cerrar la calle a los coches, y ahora los niños montan en
+bicicleta por donde antes pasaban los autobuses. Si quieres visitarlo, toma el
+camino pequeño que bordea el lago y para en la panadería que hay junto a la iglesia,
+donde hacen el pan ellos mismos.`,
+
+	LanguageFrench: `Tous les êtres humains naissent libres et égaux en dignité et en droits.
+Ils sont doués de raison et de conscience et doivent agir les uns envers les autres
+dans un esprit de fraternité. Chacun peut se prévaloir de tous les droits et de
+toutes les libertés proclamés dans la présente déclaration, sans distinction aucune,
+notamment de race, de couleur, de sexe, de langue, de religion, d'opinion politique
+ou de toute autre opinion, d'origine nationale ou sociale, de fortune, de naissance
+ou de toute autre situation. Tout individu a droit à la vie, à la liberté et à la
+sûreté de sa personne. Ce matin il faisait froid et gris, alors nous sommes restés
+à la maison avec une tasse de thé pour lire le journal pendant que les enfants
+jouaient avec leurs amis dans le jardin. Laquelle de ces maisons préférez-vous,
+celle qui est près de la rivière ou celle qui a été construite sur la colline ?
+Ils ne pouvaient rien faire, parce que le train avait déjà quitté la gare.
+Le samedi, le marché de la vieille place est plein de gens qui achètent des
+légumes, du pain et du fromage. Ma grand-mère disait toujours que les meilleures
+tomates sont vendues par les paysans qui arrivent tôt, avant que le soleil ne soit
+trop chaud. L'année dernière, la ville a décidé de fermer la rue aux voitures, et
+maintenant les enfants font du vélo là où passaient les autobus. Si vous voulez la
+visiter, prenez la petite route qui longe le lac et arrêtez-vous à la boulangerie
+à côté de l'église, où ils font le pain eux-mêmes.`,
+
+	LanguageGerman: `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind
+mit Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit
+begegnen. Jeder hat Anspruch auf alle in dieser Erklärung verkündeten Rechte und
+Freiheiten ohne irgendeinen Unterschied, etwa nach Rasse, Hautfarbe, Geschlecht,
+Sprache, Religion, politischer oder sonstiger Überzeugung, nationaler oder sozialer
+Herkunft, Vermögen, Geburt oder sonstigem Stand. Jeder hat das Recht auf Leben,
+Freiheit und Sicherheit der Person. Heute morgen war es kalt und grau, deshalb sind
+wir mit einer Kanne Tee zu Hause geblieben und haben die Zeitung gelesen, während
+die Kinder mit ihren Freunden im Garten gespielt haben. Welches von diesen Häusern
+möchtest du lieber, das Haus am Fluss oder das, welches auf dem Hügel gebaut wurde?
+Sie konnten nichts mehr dagegen tun, weil der Zug schon abgefahren war.
+Samstags ist der Markt auf dem alten Platz voller Leute, die Gemüse, Brot und
+Käse kaufen. Meine Großmutter hat immer gesagt, dass die besten Tomaten von den
+Bauern verkauft werden, die früh kommen, bevor die Sonne zu heiß wird. Letztes
+Jahr hat die Stadt beschlossen, die Straße für Autos zu sperren, und jetzt fahren
+die Kinder mit ihren Fahrrädern dort, wo früher die Busse gefahren sind. Wenn du
+sie besuchen willst, nimm die kleine Straße am See entlang und halte bei der
+Bäckerei neben der Kirche, wo das Brot noch selbst gebacken wird.`,
+
+	LanguageItalian: `Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti.
+Essi sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri
+in spirito di fratellanza. Ad ogni individuo spettano tutti i diritti e tutte le
+libertà enunciate nella presente dichiarazione, senza distinzione alcuna, per
+ragioni di razza, di colore, di sesso, di lingua, di religione, di opinione politica
+o di altro genere, di origine nazionale o sociale, di ricchezza, di nascita o di
+altra condizione. Ogni individuo ha diritto alla vita, alla libertà ed alla
+sicurezza della propria persona. Stamattina faceva freddo e il cielo era grigio,
+quindi siamo rimasti in casa con una tazza di tè a leggere il giornale mentre i
+bambini giocavano con i loro amici nel giardino. Quale di queste case preferisci,
+quella vicino al fiume o quella che hanno costruito sulla collina? Non potevano
+fare niente, perché il treno era già partito dalla stazione quando sono arrivati.
+Il sabato il mercato della piazza vecchia è pieno di gente che compra verdura,
+pane e formaggio. Mia nonna diceva sempre che i pomodori migliori li vendono i
+contadini che arrivano presto, prima che il sole diventi troppo caldo. L'anno
+scorso il paese ha deciso di chiudere la strada alle macchine, e adesso i bambini
+vanno in bicicletta dove prima passavano gli autobus. Se vuoi visitarlo, prendi la
+stradina che costeggia il lago e fermati al forno accanto alla chiesa, dove fanno
+il pane da soli.`,
+
+	LanguagePortuguese: `Todos os seres humanos nascem livres e iguais em dignidade e em direitos.
+Dotados de razão e de consciência, devem agir uns para com os outros em espírito
+de fraternidade. Todos os seres humanos podem invocar os direitos e as liberdades
+proclamados na presente declaração, sem distinção alguma, nomeadamente de raça, de
+cor, de sexo, de língua, de religião, de opinião política ou outra, de origem
+nacional ou social, de fortuna, de nascimento ou de qualquer outra situação. Todo
+o indivíduo tem direito à vida, à liberdade e à segurança pessoal. Esta manhã
+estava frio e cinzento, então ficamos em casa com um bule de chá a ler o jornal
+enquanto as crianças brincavam com os seus amigos no jardim. Qual destas casas
+você prefere, a que fica perto do rio ou aquela que foi construída no alto da
+colina? Eles não puderam fazer nada, porque o comboio já tinha saído da estação
+quando eles chegaram.
+Aos sábados o mercado da praça velha fica cheio de gente que compra legumes, pão
+e queijo. A minha avó dizia sempre que os melhores tomates são vendidos pelos
+agricultores que chegam cedo, antes que o sol fique quente demais. No ano passado
+a cidade decidiu fechar a rua aos carros, e agora as crianças andam de bicicleta
+onde antes passavam os ônibus. Se você quiser visitá-la, pegue a estrada pequena
+que segue ao longo do lago e pare na padaria ao lado da igreja, onde eles mesmos
+fazem o pão.`,
+
+	LanguageDutch: `Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij
+zijn begiftigd met verstand en geweten, en behoren zich jegens elkander in een
+geest van broederschap te gedragen. Een ieder heeft aanspraak op alle rechten en
+vrijheden, in deze verklaring opgesomd, zonder enig onderscheid van welke aard
+ook, zoals ras, kleur, geslacht, taal, godsdienst, politieke of andere
+overtuiging, nationale of maatschappelijke afkomst, eigendom, geboorte of andere
+status. Een ieder heeft het recht op leven, vrijheid en onschendbaarheid van zijn
+persoon. Vanochtend was het koud en grijs, dus zijn we met een pot thee thuis
+gebleven en hebben we de krant gelezen terwijl de kinderen met hun vrienden in de
+tuin speelden. Welk van deze huizen heb je liever, het huis bij de rivier of het
+huis dat op de heuvel is gebouwd? Zij konden er niets meer aan doen, omdat de
+trein al uit het station was vertrokken toen zij aankwamen.
+Op zaterdag staat de markt op het oude plein vol met mensen die groente, brood en
+kaas kopen. Mijn grootmoeder zei altijd dat de beste tomaten worden verkocht door
+de boeren die vroeg komen, voordat de zon te heet wordt. Vorig jaar heeft de stad
+besloten de straat voor auto's af te sluiten, en nu fietsen de kinderen waar
+vroeger de bussen reden. Als je er naartoe wilt, neem dan het kleine weggetje
+langs het meer en stop bij de bakker naast de kerk, waar ze het brood zelf bakken.`,
+}
@@ -0,0 +1,121 @@
+package wordfreq
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := []struct {
+		name           string
+		text           string
+		expectLanguage string
+	}{
+		{name: "english", expectLanguage: LanguageEnglish,
+			text: `The committee met on Thursday evening to discuss the new library. Most of the
+				members agreed that the building should open before the end of the summer, although
+				several people worried about the cost of the repairs.`},
+		{name: "spanish", expectLanguage: LanguageSpanish,
+			text: `El comité se reunió el jueves por la tarde para hablar de la nueva biblioteca.
+				La mayoría de los miembros estuvo de acuerdo en que el edificio debería abrir antes
+				del final del verano, aunque varias personas se preocuparon por el costo de las
+				reparaciones y pidieron más información al ayuntamiento.`},
+		{name: "french", expectLanguage: LanguageFrench,
+			text: `Le comité s'est réuni jeudi soir pour parler de la nouvelle bibliothèque. La
+				plupart des membres ont convenu que le bâtiment devrait ouvrir avant la fin de
+				l'été, bien que plusieurs personnes se soient inquiétées du coût des travaux.`},
+		{name: "german", expectLanguage: LanguageGerman,
+			text: `Der Ausschuss traf sich am Donnerstagabend, um über die neue Bibliothek zu
+				sprechen. Die meisten Mitglieder waren sich einig, dass das Gebäude vor dem Ende
+				des Sommers öffnen sollte, obwohl einige Leute sich über die Kosten sorgten.`},
+		{name: "italian", expectLanguage: LanguageItalian,
+			text: `Il comitato si è riunito giovedì sera per parlare della nuova biblioteca. La
+				maggior parte dei membri era d'accordo che l'edificio dovesse aprire prima della
+				fine dell'estate, anche se diverse persone erano preoccupate per i costi.`},
+		{name: "portuguese", expectLanguage: LanguagePortuguese,
+			text: `O comitê se reuniu na quinta-feira à noite para falar sobre a nova biblioteca.
+				A maioria dos membros concordou que o prédio deveria abrir antes do fim do verão,
+				embora várias pessoas estivessem preocupadas com o custo das obras.`},
+		{name: "dutch", expectLanguage: LanguageDutch,
+			text: `De commissie kwam donderdagavond bijeen om over de nieuwe bibliotheek te
+				praten. De meeste leden waren het erover eens dat het gebouw voor het einde van de
+				zomer open moest gaan, hoewel sommige mensen zich zorgen maakten over de kosten.`},
+		{name: "one sentence", expectLanguage: LanguageEnglish,
+			text: `The committee met on Thursday.`},
+		{name: "too short", expectLanguage: "",
+			text: `Hello, world.`},
+		{name: "empty", expectLanguage: "",
+			text: ``},
+		{name: "mixed", expectLanguage: "",
+			text: `The committee met on Thursday. Der Ausschuss traf sich am Donnerstag. Le comité
+				s'est réuni jeudi. El comité se reunió el jueves. Il comitato si è riunito giovedì.
+				O comitê se reuniu na quinta-feira. De commissie kwam donderdag bijeen.`},
+		{name: "source code", expectLanguage: "",
+			text: `func (c *WordCounts) Close() error {
+				if !c.Spilled() {
+					return nil
+				}
+				err := os.Remove(c.spillFile)
+				c.spillFile = ""
+				return err
+			}
+			for i, ngram := range ngrams {
+				profile[ngram] = i
+			}`},
+		{name: "json", expectLanguage: "",
+			text: `{"Bucket":"my-bucket","Key":"docs/report.txt","ETag":"3858f62230ac3c915f300c664312c63f",
+				"Status":"JobCompleteSuccess","Words":[{"Word":"committee","Count":12},{"Word":"library",
+				"Count":9}],"Vocabulary":1204,"Total":5120,"Duration":125000000}`},
+		{name: "base64", expectLanguage: "",
+			text: `TG9yZW0gaXBzdW0gZG9sb3Igc2l0IGFtZXQsIGNvbnNlY3RldHVyIGFkaXBpc2NpbmcgZWxpdCwgc2VkIGRv
+				IGVpdXNtb2QgdGVtcG9yIGluY2lkaWR1bnQgdXQgbGFib3JlIGV0IGRvbG9yZSBtYWduYSBhbGlxdWEuIFV0IGVu
+				aW0gYWQgbWluaW0gdmVuaWFtLCBxdWlzIG5vc3RydWQgZXhlcmNpdGF0aW9uIHVsbGFtY28gbGFib3Jpcw==`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			language, confidence := DetectLanguage(c.text)
+			if e, a := c.expectLanguage, language; e != a {
+				t.Errorf("expect %q language, got %q with confidence %v", e, a, confidence)
+			}
+			if language == "" && confidence != 0 {
+				t.Errorf("expect no confidence without a language, got %v", confidence)
+			}
+			if language != "" && (confidence < languageMinConfidence || confidence > 1) {
+				t.Errorf("expect confidence from %v to 1, got %v", languageMinConfidence, confidence)
+			}
+		})
+	}
+}
+
+func TestStopwordsShorterThanMinWordLength(t *testing.T) {
+	for language, settings := range languageSettings {
+		for word := range settings.Stopwords {
+			if len(word) >= DefaultMinWordLength {
+				t.Errorf("%s: expect stopwords shorter than %d, got %q",
+					language, DefaultMinWordLength, word)
+			}
+		}
+	}
+}
+
+func TestCountDetectedLanguageKeepsLongWords(t *testing.T) {
+	// Words the default minimum word length counts are still counted when
+	// the document's language is detected.
+	doc := strings.Repeat(`The committee would decide which of these projects should
+		start first, because there were other ideas about where their money could go after
+		the summer. `, 3)
+
+	counts, err := WordCounter{}.Count(strings.NewReader(doc), AnalysisOptions{})
+	if err != nil {
+		t.Fatalf("expect no error, got %v", err)
+	}
+	if e, a := LanguageEnglish, counts.Language; e != a {
+		t.Fatalf("expect %s language, got %s", e, a)
+	}
+	for _, word := range []string{"would", "which", "these", "should", "because", "there", "other", "about", "where", "their", "could", "after"} {
+		if e, a := 3, counts.Words[word]; e != a {
+			t.Errorf("expect %q counted %d times, got %d", word, e, a)
+		}
+	}
+}
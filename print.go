@@ -0,0 +1,343 @@
+package wordfreq
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats supported by WriteResults and WriteWords.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	FormatBars     = "bars"
+)
+
+// barWidth is the width in characters of the longest bar of the bars format.
+const barWidth = 40
+
+// IsValidFormat returns if the format is a supported output format.
+func IsValidFormat(format string) bool {
+	switch format {
+	case FormatTable, FormatJSON, FormatCSV, FormatMarkdown, FormatBars:
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteResults writes the job results to the writer in the format provided.
+// Each word includes its percentage of the total words counted for the job.
+// The CSV format has a row for each word of each result.
+func WriteResults(w io.Writer, format string, results []*JobResult) error {
+	switch format {
+	case FormatTable, FormatBars, FormatMarkdown:
+		for _, result := range results {
+			writeResultText(w, format, result)
+		}
+		return nil
+	case FormatJSON:
+		withPercents := make([]*JobResult, len(results))
+		for i, result := range results {
+			r := *result
+			r.Words = r.Words.WithPercents(result.TotalWords)
+			withPercents[i] = &r
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(withPercents)
+	case FormatCSV:
+		csvW := csv.NewWriter(w)
+		csvW.Write([]string{"bucket", "key", "status", "word", "count", "percent"})
+		for _, result := range results {
+			for _, word := range result.Words.WithPercents(result.TotalWords) {
+				csvW.Write([]string{result.Job.Bucket, result.Job.Key, string(result.Status),
+					word.Word, strconv.Itoa(word.Count), formatPercent(word.Percent)})
+			}
+		}
+		csvW.Flush()
+		return csvW.Error()
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// WriteWords writes the words under the title to the writer in the format
+// provided. Each word includes its percentage of the total words. The title
+// is only written by the table, bars, and markdown formats.
+func WriteWords(w io.Writer, format, title string, words Words, total int) error {
+	words = words.WithPercents(total)
+
+	switch format {
+	case FormatTable, FormatBars:
+		fmt.Fprintln(w, title+":")
+		writeWordsText(w, format, words)
+		return nil
+	case FormatMarkdown:
+		fmt.Fprintf(w, "### %s\n\n", title)
+		writeWordsText(w, format, words)
+		return nil
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(words)
+	case FormatCSV:
+		csvW := csv.NewWriter(w)
+		csvW.Write([]string{"word", "count", "percent"})
+		for _, word := range words {
+			csvW.Write([]string{word.Word, strconv.Itoa(word.Count), formatPercent(word.Percent)})
+		}
+		csvW.Flush()
+		return csvW.Error()
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// writeResultText writes the job result in one of the human readable formats.
+func writeResultText(w io.Writer, format string, result *JobResult) {
+	filename := result.Job.Key
+	if result.Job.Bucket != "" {
+		// Results counted locally do not have a bucket.
+		filename = result.Job.Bucket + "/" + filename
+	}
+	duration := FormatDuration(result.Duration)
+
+	if format == FormatMarkdown {
+		fmt.Fprintf(w, "### %s\n\nCompleted in %s", filename, duration)
+		if result.TotalWords > 0 {
+			fmt.Fprintf(w, ", %d words counted", result.TotalWords)
+		}
+		if result.Language != "" {
+			fmt.Fprintf(w, ", language %s", formatLanguage(result))
+		}
+		if longWords := formatLongWords(result); longWords != "" {
+			fmt.Fprintf(w, ", long words %s", longWords)
+		}
+		fmt.Fprint(w, "\n\n")
+		if result.Status == JobCompleteFailure {
+			fmt.Fprintf(w, "**Failed:** %s\n\n", result.StatusMessage)
+			return
+		}
+		writeWordsText(w, format, result.Words.WithPercents(result.TotalWords))
+		writeKeywordsText(w, format, result.Keywords)
+		return
+	}
+
+	fmt.Fprintf(w, "Job Results completed in %s for %s\n", duration, filename)
+	if result.Status == JobCompleteFailure {
+		fmt.Fprintln(w, "Failed:", result.StatusMessage)
+		return
+	}
+	if result.Language != "" {
+		fmt.Fprintln(w, "Language:", formatLanguage(result))
+	}
+	if longWords := formatLongWords(result); longWords != "" {
+		fmt.Fprintln(w, "Long Words:", longWords)
+	}
+	fmt.Fprintln(w, "Top Words:")
+	writeWordsText(w, format, result.Words.WithPercents(result.TotalWords))
+	writeKeywordsText(w, format, result.Keywords)
+}
+
+// writeKeywordsText writes the keywords of a result, if it has any, in one of
+// the human readable formats.
+func writeKeywordsText(w io.Writer, format string, keywords Keywords) {
+	if len(keywords) == 0 {
+		return
+	}
+
+	if format == FormatMarkdown {
+		fmt.Fprint(w, "#### Keywords\n\n")
+		fmt.Fprintln(w, "| Word | Count | Score |")
+		fmt.Fprintln(w, "| --- | ---: | ---: |")
+		for _, keyword := range keywords {
+			fmt.Fprintf(w, "| %s | %d | %s |\n",
+				strings.Replace(keyword.Word, "|", `\|`, -1), keyword.Count, formatScore(keyword.Score))
+		}
+		fmt.Fprintln(w)
+		return
+	}
+
+	fmt.Fprintln(w, "Keywords:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, keyword := range keywords {
+		fmt.Fprintf(tw, "- %s\t%d\t%s\n", keyword.Word, keyword.Count, formatScore(keyword.Score))
+	}
+	tw.Flush()
+}
+
+// writeWordsText writes the words in one of the human readable formats. The
+// table and bars formats are aligned in columns. Percentages are omitted for
+// words without one.
+func writeWordsText(w io.Writer, format string, words Words) {
+	if format == FormatMarkdown {
+		fmt.Fprintln(w, "| Word | Count | Percent |")
+		fmt.Fprintln(w, "| --- | ---: | ---: |")
+		for _, word := range words {
+			fmt.Fprintf(w, "| %s | %d | %s |\n",
+				strings.Replace(word.Word, "|", `\|`, -1), word.Count, formatPercent(word.Percent))
+		}
+		fmt.Fprintln(w)
+		return
+	}
+
+	maxCount := 0
+	for _, word := range words {
+		if word.Count > maxCount {
+			maxCount = word.Count
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, word := range words {
+		percent := formatPercent(word.Percent)
+		if format == FormatBars {
+			bar := strings.Repeat("█", word.Count*barWidth/maxCount)
+			fmt.Fprintf(tw, "- %s\t%s %d\t%s\n", word.Word, bar, word.Count, percent)
+		} else {
+			fmt.Fprintf(tw, "- %s\t%d\t%s\n", word.Word, word.Count, percent)
+		}
+	}
+	tw.Flush()
+}
+
+// formatLongWords formats the number of long words the result skipped and
+// truncated, or an empty string if there were none.
+func formatLongWords(result *JobResult) string {
+	var parts []string
+	if result.SkippedWords > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", result.SkippedWords))
+	}
+	if result.TruncatedWords > 0 {
+		parts = append(parts, fmt.Sprintf("%d truncated", result.TruncatedWords))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatLanguage formats the language of the result, with the confidence it
+// was detected with.
+func formatLanguage(result *JobResult) string {
+	return fmt.Sprintf("%s (%s confidence)", result.Language, formatScore(result.LanguageConfidence))
+}
+
+// formatPercent formats the percentage with two decimal places, or returns
+// an empty string if there is no percentage.
+func formatPercent(percent float64) string {
+	if percent == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(percent, 'f', 2, 64) + "%"
+}
+
+// FormatDuration formats the duration trimming less significant units based
+// on the overall duration provided.  Minutes will be limit to seconds. Seconds
+// to milliseconds. Milliseconds to microseconds.
+func FormatDuration(dur time.Duration) string {
+	nano := dur.Nanoseconds()
+	if dur > time.Minute {
+		nano = (nano / 1e9) * 1e9
+	} else if dur > time.Second {
+		nano = (nano / 1e6) * 1e6
+	} else if dur > time.Millisecond {
+		nano = (nano / 1e3) * 1e3
+	}
+	return time.Duration(nano).String()
+}
+
+// WriteComparison writes the comparison of the from and to words to the writer
+// in the format provided. The from and to names identify the words compared,
+// such as the filenames of the results. The bars format is written the same
+// as the table format. The CSV format has a row for each similarity score, and
+// for each word gained, lost, or changed.
+func WriteComparison(w io.Writer, format, fromName, toName string, c Comparison) error {
+	switch format {
+	case FormatTable, FormatBars, FormatMarkdown:
+		writeComparisonText(w, format, fromName, toName, c)
+		return nil
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			From, To string
+			Comparison
+		}{fromName, toName, c})
+	case FormatCSV:
+		csvW := csv.NewWriter(w)
+		csvW.Write([]string{"type", "word", "from_rank", "to_rank", "from_count", "to_count", "score"})
+		csvW.Write([]string{"similarity", "cosine", "", "", "", "", formatScore(c.Cosine)})
+		csvW.Write([]string{"similarity", "jaccard", "", "", "", "", formatScore(c.Jaccard)})
+		for _, word := range c.Gained {
+			csvW.Write([]string{"gained", word.Word, "", "", "", strconv.Itoa(word.Count), ""})
+		}
+		for _, word := range c.Lost {
+			csvW.Write([]string{"lost", word.Word, "", "", strconv.Itoa(word.Count), "", ""})
+		}
+		for _, change := range c.Changed {
+			csvW.Write([]string{"changed", change.Word,
+				strconv.Itoa(change.FromRank), strconv.Itoa(change.ToRank),
+				strconv.Itoa(change.FromCount), strconv.Itoa(change.ToCount), ""})
+		}
+		csvW.Flush()
+		return csvW.Error()
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// writeComparisonText writes the comparison in one of the human readable
+// formats.
+func writeComparisonText(w io.Writer, format, fromName, toName string, c Comparison) {
+	if format == FormatMarkdown {
+		fmt.Fprintf(w, "### Comparison of %s and %s\n\n", fromName, toName)
+		fmt.Fprintf(w, "- Cosine similarity: %s\n", formatScore(c.Cosine))
+		fmt.Fprintf(w, "- Jaccard similarity: %s\n\n", formatScore(c.Jaccard))
+		fmt.Fprint(w, "#### Gained\n\n")
+		writeWordsText(w, format, c.Gained)
+		fmt.Fprint(w, "#### Lost\n\n")
+		writeWordsText(w, format, c.Lost)
+		fmt.Fprint(w, "#### Changed\n\n")
+		fmt.Fprintln(w, "| Word | Rank | Count |")
+		fmt.Fprintln(w, "| --- | --- | --- |")
+		for _, change := range c.Changed {
+			fmt.Fprintf(w, "| %s | %s | %d -> %d |\n",
+				strings.Replace(change.Word, "|", `\|`, -1), formatRankChange(change),
+				change.FromCount, change.ToCount)
+		}
+		fmt.Fprintln(w)
+		return
+	}
+
+	fmt.Fprintf(w, "Comparison of %s and %s\n", fromName, toName)
+	fmt.Fprintln(w, "Cosine similarity: ", formatScore(c.Cosine))
+	fmt.Fprintln(w, "Jaccard similarity:", formatScore(c.Jaccard))
+	fmt.Fprintln(w, "Gained:")
+	writeWordsText(w, FormatTable, c.Gained)
+	fmt.Fprintln(w, "Lost:")
+	writeWordsText(w, FormatTable, c.Lost)
+	fmt.Fprintln(w, "Changed:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, change := range c.Changed {
+		fmt.Fprintf(tw, "- %s\t%s\t%d -> %d\n", change.Word, formatRankChange(change),
+			change.FromCount, change.ToCount)
+	}
+	tw.Flush()
+}
+
+// formatRankChange formats the ranks the word moved between, and the number
+// of ranks it moved.
+func formatRankChange(change WordChange) string {
+	return fmt.Sprintf("#%d -> #%d (%+d)", change.FromRank, change.ToRank, change.RankDelta())
+}
+
+// formatScore formats the similarity score with four decimal places.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', 4, 64)
+}
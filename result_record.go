@@ -0,0 +1,192 @@
+package wordfreq
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A ResultRecord represents the result item of a job in the DynamoDB result
+// table. The table's hash key is the Filename, which is the bucket and key of
+// the object joined by "/".
+type ResultRecord struct {
+	Filename string // Table hash key
+	// Range key of the item in the history table, empty in the result table.
+	Attempt string `json:",omitempty"`
+	Words   map[string]int
+
+	ETag      string `json:",omitempty"`
+	VersionID string `json:",omitempty"`
+	Sequencer string `json:",omitempty"`
+
+	// Set if the object was removed, and this item is a tombstone.
+	Removed bool `json:",omitempty"`
+
+	// Correlation ID of the job, if one was provided.
+	CorrelationID string `json:",omitempty"`
+
+	// Status of the job, and error if the job failed.
+	Status        JobCompleteStatus
+	StatusMessage string       `json:",omitempty"`
+	ErrorCode     JobErrorCode `json:",omitempty"`
+
+	// When and where the job was processed, and the options used.
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+	WorkerHost string `json:",omitempty"`
+	Options    AnalysisOptions
+
+	// Metadata of the object the words were counted from.
+	ObjectSize  int64  `json:",omitempty"`
+	ContentType string `json:",omitempty"`
+
+	// Number of words counted, the number of unique words counted, and the
+	// location of the full histogram of words in S3 if it was written.
+	TotalWords     int                `json:",omitempty"`
+	VocabularySize int                `json:",omitempty"`
+	Histogram      *HistogramLocation `json:",omitempty"`
+
+	// Language the words were counted as, and the detection confidence.
+	Language           string  `json:",omitempty"`
+	LanguageConfidence float64 `json:",omitempty"`
+	// Character encoding the object was transcoded to UTF-8 from.
+	Charset string `json:",omitempty"`
+	// Long words skipped, and truncated, by the job's long word policy.
+	SkippedWords   int `json:",omitempty"`
+	TruncatedWords int `json:",omitempty"`
+
+	// TF-IDF keywords of the object, if aggregates were recorded.
+	Keywords Keywords `json:",omitempty"`
+}
+
+// NewResultRecord creates the result item for the job result, processed by
+// a worker running on the host.
+func NewResultRecord(result *JobResult, host string) ResultRecord {
+	record := ResultRecord{
+		Filename:  path.Join(result.Job.Bucket, result.Job.Key),
+		Words:     map[string]int{},
+		ETag:      result.Job.ETag,
+		VersionID: result.Job.VersionID,
+		Sequencer: result.Job.Sequencer,
+		Removed:   result.Job.Action == JobActionRemove,
+
+		CorrelationID: result.Job.CorrelationID,
+
+		Status:        result.Status,
+		StatusMessage: result.StatusMessage,
+		ErrorCode:     result.ErrorCode,
+		StartedAt:     result.Job.StartedAt,
+		FinishedAt:    result.FinishedAt,
+		Duration:      result.Duration,
+		WorkerHost:    host,
+		Options:       result.Job.Options,
+
+		ObjectSize:  result.ObjectSize,
+		ContentType: result.ContentType,
+
+		TotalWords:     result.TotalWords,
+		VocabularySize: result.VocabularySize,
+		Histogram:      result.Histogram,
+		Keywords:       result.Keywords,
+
+		Language:           result.Language,
+		LanguageConfidence: result.LanguageConfidence,
+		Charset:            result.Charset,
+		SkippedWords:       result.SkippedWords,
+		TruncatedWords:     result.TruncatedWords,
+	}
+	for _, w := range result.Words {
+		record.Words[w.Word] = w.Count
+	}
+
+	return record
+}
+
+// HistoryAttemptAttr is the range key of the job history table. Each attempt
+// to process a job is recorded as a separate item of the history table, with
+// the same Filename hash key as the result table.
+const HistoryAttemptAttr = "Attempt"
+
+// historyAttemptTimeFormat is the fixed width format of the time of history
+// attempts, so the attempts are sorted by time.
+const historyAttemptTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// NewHistoryRecord creates the history item of an attempt to process the job,
+// by a worker running on the host. The attempt is identified by the time it
+// finished, and the job's message ID.
+func NewHistoryRecord(result *JobResult, host string) ResultRecord {
+	record := NewResultRecord(result, host)
+	record.Attempt = result.FinishedAt.UTC().Format(historyAttemptTimeFormat) +
+		"#" + result.Job.OrigMessage.ID
+	return record
+}
+
+// JobResult converts the result item back into the job result it was
+// recorded from. Items recorded before the status was included are
+// successful results.
+func (r ResultRecord) JobResult() *JobResult {
+	bucket, key := r.Filename, ""
+	if i := strings.Index(r.Filename, "/"); i >= 0 {
+		bucket, key = r.Filename[:i], r.Filename[i+1:]
+	}
+
+	action := JobActionCount
+	if r.Removed {
+		action = JobActionRemove
+	}
+	status := r.Status
+	if status == "" {
+		status = JobCompleteSuccess
+	}
+
+	return &JobResult{
+		Job: &Job{
+			StartedAt: r.StartedAt,
+			Action:    action,
+			Bucket:    bucket,
+			Key:       key,
+			ETag:      r.ETag,
+			VersionID: r.VersionID,
+			Sequencer: r.Sequencer,
+			Options:   r.Options,
+
+			CorrelationID: r.CorrelationID,
+		},
+		Words:          NewWords(r.Words),
+		Duration:       r.Duration,
+		FinishedAt:     r.FinishedAt,
+		Status:         status,
+		StatusMessage:  r.StatusMessage,
+		ErrorCode:      r.ErrorCode,
+		ObjectSize:     r.ObjectSize,
+		ContentType:    r.ContentType,
+		TotalWords:     r.TotalWords,
+		VocabularySize: r.VocabularySize,
+		Histogram:      r.Histogram,
+		Keywords:       r.Keywords,
+
+		Language:           r.Language,
+		LanguageConfidence: r.LanguageConfidence,
+		Charset:            r.Charset,
+		SkippedWords:       r.SkippedWords,
+		TruncatedWords:     r.TruncatedWords,
+	}
+}
+
+// NewWords converts the word map into an array sorted by count, with words of
+// equal count sorted alphabetically so the order is repeatable.
+func NewWords(wordMap map[string]int) Words {
+	words := make(Words, 0, len(wordMap))
+	for word, count := range wordMap {
+		words = append(words, Word{Word: word, Count: count})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	return words
+}
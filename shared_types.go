@@ -3,24 +3,99 @@ package wordfreq
 import "time"
 
 type Job struct {
+	// When a worker started processing the job. ReceivedAt is when the job's
+	// message was received, which its visibility timeout is relative to.
 	StartedAt           time.Time
+	ReceivedAt          time.Time  `json:"-"`
 	VisibilityTimeout   int64      `json:"-"`
 	OrigMessage         JobMessage `json:"-"`
+	Action              JobAction
 	Region, Bucket, Key string
+
+	// Identity of the object version the job was created for. Used to detect
+	// duplicate and out of order S3 event notifications.
+	ETag      string `json:",omitempty"`
+	VersionID string `json:",omitempty"`
+	Sequencer string `json:",omitempty"`
+
+	// Options the job's words will be counted with.
+	Options AnalysisOptions
+	// Caller provided values of a JobRequest. Results of the job are sent to
+	// the ReplyTo SQS queue URL if set, instead of the worker's result queue.
+	CorrelationID string `json:",omitempty"`
+	ReplyTo       string `json:",omitempty"`
 }
 
+// Names of the S3 object user metadata an uploader can set to receive the
+// result of the object's job directly. The correlation ID is included in the
+// job's result, and the result is sent to the reply to SQS queue URL.
+const (
+	CorrelationIDMetadata = "correlation-id"
+	ReplyToMetadata       = "reply-to"
+)
+
+// CorrelationIDAttribute is the name of the SQS message attribute result
+// messages include the job's correlation ID in.
+const CorrelationIDAttribute = "CorrelationId"
+
+// A JobAction is the action the worker should take for a job.
+type JobAction string
+
+const (
+	// JobActionCount counts the words of the object.
+	JobActionCount JobAction = "count"
+	// JobActionRemove removes the recorded result of an object that was deleted.
+	JobActionRemove JobAction = "remove"
+)
+
 type JobMessage struct {
 	ID            string
 	ReceiptHandle string
 	Body          string
+	ReceiveCount  int
 }
 
 type JobResult struct {
 	Job           *Job
 	Words         Words
 	Duration      time.Duration
+	FinishedAt    time.Time
 	Status        JobCompleteStatus
 	StatusMessage string
+	ErrorCode     JobErrorCode `json:",omitempty"`
+
+	// Metadata of the object the words were counted from.
+	ObjectSize  int64  `json:",omitempty"`
+	ContentType string `json:",omitempty"`
+
+	// Number of words counted, and the number of unique words counted.
+	TotalWords     int `json:",omitempty"`
+	VocabularySize int `json:",omitempty"`
+	// Language the words were counted as, and the confidence it was detected
+	// with. Empty if the language could not be detected.
+	Language           string  `json:",omitempty"`
+	LanguageConfidence float64 `json:",omitempty"`
+	// Character encoding the object was transcoded to UTF-8 from.
+	Charset string `json:",omitempty"`
+	// Number of words longer than the job's maximum word length which were
+	// skipped, or truncated, by the job's long word policy.
+	SkippedWords   int `json:",omitempty"`
+	TruncatedWords int `json:",omitempty"`
+	// Location of the full histogram of words counted, if written.
+	Histogram *HistogramLocation `json:",omitempty"`
+	// Words distinctive to the object compared to the other objects of its
+	// aggregate scope, scored by TF-IDF. Only set if aggregates are recorded.
+	Keywords Keywords `json:",omitempty"`
+}
+
+// A HistogramLocation is the location in S3 of the compressed full histogram
+// of words counted for a job.
+type HistogramLocation struct {
+	Bucket, Key string
+	// Format of the histogram, "json" or "csv". Always gzip compressed.
+	Format string
+	// Hex encoded SHA-256 checksum of the compressed histogram object.
+	Checksum string
 }
 
 type JobCompleteStatus string
@@ -28,15 +103,31 @@ type JobCompleteStatus string
 const (
 	JobCompleteSuccess JobCompleteStatus = "success"
 	JobCompleteFailure                   = "failure"
+	JobCompleteSkipped                   = "skipped"
 )
 
 type Word struct {
 	Word  string
 	Count int
+	// Percentage of the total words counted. Only set for output.
+	Percent float64 `json:",omitempty"`
 }
 
 type Words []Word
 
+// WithPercents returns a copy of the words with the percentage of the total
+// set for each word. If the total is unknown, zero, the percentages are not set.
+func (w Words) WithPercents(total int) Words {
+	words := make(Words, len(w))
+	copy(words, w)
+	if total > 0 {
+		for i := range words {
+			words[i].Percent = float64(words[i].Count) * 100 / float64(total)
+		}
+	}
+	return words
+}
+
 func (w Words) Len() int {
 	return len(w)
 }
@@ -0,0 +1,434 @@
+package wordfreq
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// wordEntryOverhead is the approximate number of bytes of memory used by
+	// each word count in addition to the word itself.
+	wordEntryOverhead = 64
+	// maxMergeFiles is the maximum number of spilled files merged at once.
+	// More files are merged in multiple passes.
+	maxMergeFiles = 64
+)
+
+// WordCounts are the counts of all words counted from a document, and the
+// language the document was counted as. If the counts exceeded the counter's
+// memory budget they are spilled to disk, and Words is nil. The counts must be
+// closed when no longer needed to remove the spilled counts.
+type WordCounts struct {
+	// Counts of all words, if the counts are held in memory.
+	Words map[string]int
+	// Total number of words, and number of unique words, counted.
+	Total      int
+	Vocabulary int
+	// Most common words counted, sorted by count, then alphabetically.
+	Top Words
+
+	// Language of the document, either the language of the options, or the
+	// detected language. Empty if the language could not be detected.
+	Language string
+	// Confidence the language was detected with, from 0 to 1. Languages set by
+	// the options have a confidence of 1.
+	LanguageConfidence float64
+	// Number of words longer than the maximum word length which were skipped,
+	// or truncated, by the long word policy.
+	SkippedWords   int
+	TruncatedWords int
+
+	// File of the merged counts spilled to disk, sorted by word.
+	spillFile string
+}
+
+// Spilled returns if the counts were spilled to disk.
+func (c *WordCounts) Spilled() bool {
+	return c.spillFile != ""
+}
+
+// Each calls fn with each word, and its count, sorted by word. The order is the
+// same whether or not the counts were spilled, so the same counts are always
+// iterated in the same order. If fn returns an error iteration stops, and the
+// error is returned.
+func (c *WordCounts) Each(fn func(word string, count int) error) error {
+	if !c.Spilled() {
+		words := make([]string, 0, len(c.Words))
+		for word := range c.Words {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+		for _, word := range words {
+			if err := fn(word, c.Words[word]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r, err := openSpillReader(c.spillFile)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	for {
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err := fn(r.word, r.count); err != nil {
+			return err
+		}
+	}
+}
+
+// Close removes the counts spilled to disk, if there are any.
+func (c *WordCounts) Close() error {
+	if !c.Spilled() {
+		return nil
+	}
+	err := os.Remove(c.spillFile)
+	c.spillFile = ""
+	return err
+}
+
+// A spillAccumulator accumulates word counts in memory until they exceed the
+// counter's memory budget, then spills them to a file sorted by word.
+type spillAccumulator struct {
+	counter WordCounter
+	words   map[string]int
+	used    int64
+	files   []string
+}
+
+// newSpillAccumulator creates a spillAccumulator for the counter.
+func newSpillAccumulator(counter WordCounter) *spillAccumulator {
+	return &spillAccumulator{counter: counter, words: map[string]int{}}
+}
+
+// add adds the count of the word, spilling the counts if they exceed the
+// memory budget.
+func (a *spillAccumulator) add(word string, count int) error {
+	if _, ok := a.words[word]; !ok {
+		a.used += int64(len(word)) + wordEntryOverhead
+	}
+	a.words[word] += count
+
+	if a.counter.Progress != nil {
+		if err := a.counter.Progress(); err != nil {
+			return err
+		}
+	}
+	if a.counter.MemoryBudget > 0 && a.used > a.counter.MemoryBudget {
+		return a.spill()
+	}
+	return nil
+}
+
+// spill writes the counts in memory to a file sorted by word, and resets the
+// counts in memory.
+func (a *spillAccumulator) spill() error {
+	words := make([]string, 0, len(a.words))
+	for word := range a.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	filename, err := a.writeSpillFile(func(emit func(string, int) error) error {
+		for _, word := range words {
+			if err := emit(word, a.words[word]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to spill word counts, %v", err)
+	}
+
+	a.files = append(a.files, filename)
+	a.words = map[string]int{}
+	a.used = 0
+	return nil
+}
+
+// finish completes the accumulation of the counts. If the counts were never
+// spilled they are returned in memory, otherwise the remaining counts are
+// spilled, and all spilled files are merged into a single file.
+func (a *spillAccumulator) finish(top int) (*WordCounts, error) {
+	if len(a.files) == 0 {
+		return &WordCounts{
+			Words:      a.words,
+			Total:      TotalWords(a.words),
+			Vocabulary: len(a.words),
+			Top:        TopWords(a.words, top),
+		}, nil
+	}
+
+	if len(a.words) > 0 {
+		if err := a.spill(); err != nil {
+			a.remove()
+			return nil, err
+		}
+	}
+
+	// Merge the files in multiple passes if there are too many files to
+	// have open at once.
+	for len(a.files) > maxMergeFiles {
+		var merged []string
+		for i := 0; i < len(a.files); i += maxMergeFiles {
+			end := i + maxMergeFiles
+			if end > len(a.files) {
+				end = len(a.files)
+			}
+			filename, err := a.writeSpillFile(func(emit func(string, int) error) error {
+				return mergeSpillFiles(a.files[i:end], emit)
+			})
+			if err != nil {
+				a.remove()
+				removeFiles(merged)
+				return nil, fmt.Errorf("failed to merge spilled word counts, %v", err)
+			}
+			merged = append(merged, filename)
+		}
+		removeFiles(a.files)
+		a.files = merged
+	}
+
+	counts := &WordCounts{}
+	topWords := newTopWordsHeap(top)
+	filename, err := a.writeSpillFile(func(emit func(string, int) error) error {
+		return mergeSpillFiles(a.files, func(word string, count int) error {
+			counts.Total += count
+			counts.Vocabulary++
+			topWords.add(Word{Word: word, Count: count})
+			return emit(word, count)
+		})
+	})
+	a.remove()
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge spilled word counts, %v", err)
+	}
+
+	counts.Top = topWords.words()
+	counts.spillFile = filename
+	return counts, nil
+}
+
+// remove removes all of the spilled files.
+func (a *spillAccumulator) remove() {
+	removeFiles(a.files)
+	a.files = nil
+}
+
+// writeSpillFile creates a new spill file in the counter's temporary
+// directory, and writes the counts emitted by the write function to it.
+// Returns the name of the file.
+func (a *spillAccumulator) writeSpillFile(write func(emit func(string, int) error) error) (string, error) {
+	f, err := ioutil.TempFile(a.counter.TempDir, "wordfreq-spill-")
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(f)
+	err = write(func(word string, count int) error {
+		if a.counter.Progress != nil {
+			if err := a.counter.Progress(); err != nil {
+				return err
+			}
+		}
+		w.WriteString(word)
+		w.WriteByte(' ')
+		w.WriteString(strconv.Itoa(count))
+		return w.WriteByte('\n')
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// removeFiles removes all of the files, ignoring errors.
+func removeFiles(filenames []string) {
+	for _, filename := range filenames {
+		os.Remove(filename)
+	}
+}
+
+// mergeSpillFiles merges the spilled files, which are each sorted by word,
+// emitting each word and its combined count in word order.
+func mergeSpillFiles(filenames []string, emit func(string, int) error) error {
+	readers := spillReaderHeap{}
+	defer func() {
+		for _, r := range readers {
+			r.close()
+		}
+	}()
+	for _, filename := range filenames {
+		r, err := openSpillReader(filename)
+		if err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil || !ok {
+			r.close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		readers = append(readers, r)
+	}
+	heap.Init(&readers)
+
+	for len(readers) > 0 {
+		word, count := readers[0].word, 0
+		for len(readers) > 0 && readers[0].word == word {
+			r := readers[0]
+			count += r.count
+			ok, err := r.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&readers, 0)
+			} else {
+				heap.Pop(&readers)
+				r.close()
+			}
+		}
+		if err := emit(word, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A spillReader reads the word counts of a spill file.
+type spillReader struct {
+	f     *os.File
+	r     *bufio.Reader
+	word  string
+	count int
+}
+
+// openSpillReader opens the spill file for reading.
+func openSpillReader(filename string) (*spillReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &spillReader{f: f, r: bufio.NewReader(f)}, nil
+}
+
+// next reads the next word count, returning false once all counts are read.
+func (r *spillReader) next() (bool, error) {
+	line, err := r.r.ReadString('\n')
+	if len(line) == 0 && err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	i := strings.LastIndexByte(line, ' ')
+	if i < 0 {
+		return false, fmt.Errorf("invalid spilled word count %q", line)
+	}
+	count, err := strconv.Atoi(line[i+1:])
+	if err != nil {
+		return false, fmt.Errorf("invalid spilled word count %q", line)
+	}
+	r.word, r.count = line[:i], count
+	return true, nil
+}
+
+// close closes the spill file.
+func (r *spillReader) close() {
+	r.f.Close()
+}
+
+// spillReaderHeap is a min heap of spill readers ordered by their current word.
+type spillReaderHeap []*spillReader
+
+func (h spillReaderHeap) Len() int            { return len(h) }
+func (h spillReaderHeap) Less(i, j int) bool  { return h[i].word < h[j].word }
+func (h spillReaderHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *spillReaderHeap) Push(x interface{}) { *h = append(*h, x.(*spillReader)) }
+func (h *spillReaderHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// A topWordsHeap collects the top most common words added to it. If top is
+// zero all words are collected.
+type topWordsHeap struct {
+	top  int
+	heap wordHeap
+}
+
+// newTopWordsHeap creates a topWordsHeap collecting the top words.
+func newTopWordsHeap(top int) *topWordsHeap {
+	return &topWordsHeap{top: top}
+}
+
+// add adds the word, removing the least common word if there are more than
+// the top words.
+func (t *topWordsHeap) add(word Word) {
+	heap.Push(&t.heap, word)
+	if t.top > 0 && len(t.heap) > t.top {
+		heap.Pop(&t.heap)
+	}
+}
+
+// words returns the words collected sorted by count, then alphabetically.
+func (t *topWordsHeap) words() Words {
+	words := Words(append([]Word{}, t.heap...))
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	return words
+}
+
+// wordHeap is a min heap of words ordered by the least common word, with
+// words of equal count ordered reverse alphabetically.
+type wordHeap []Word
+
+func (h wordHeap) Len() int { return len(h) }
+func (h wordHeap) Less(i, j int) bool {
+	if h[i].Count != h[j].Count {
+		return h[i].Count < h[j].Count
+	}
+	return h[i].Word > h[j].Word
+}
+func (h wordHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *wordHeap) Push(x interface{}) { *h = append(*h, x.(Word)) }
+func (h *wordHeap) Pop() interface{} {
+	old := *h
+	w := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,227 @@
+package wordfreq
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDocument returns a document of numWords unique words, where the count of
+// each word is from one to seven, so many words have the same count.
+func testDocument(numWords int) string {
+	var b strings.Builder
+	for i := 0; i < numWords; i++ {
+		for n := 0; n <= i%7; n++ {
+			fmt.Fprintf(&b, "word%05d ", i)
+		}
+		if i%10 == 0 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// eachWords returns the words of the counts in the order Each iterates them.
+func eachWords(t *testing.T, counts *WordCounts) Words {
+	words := Words{}
+	err := counts.Each(func(word string, count int) error {
+		words = append(words, Word{Word: word, Count: count})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expect no error iterating counts, got %v", err)
+	}
+	return words
+}
+
+// tempFiles returns the names of the files in the directory.
+func tempFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expect no error reading %s, got %v", dir, err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestCountSpilledMatchesInMemory(t *testing.T) {
+	cases := []struct {
+		name      string
+		numWords  int
+		budget    int64
+		top       int
+		minSpills int
+	}{
+		{name: "single pass", numWords: 500, budget: 2000, top: 10, minSpills: 2},
+		{name: "ties at top", numWords: 700, budget: 4000, top: 3, minSpills: 2},
+		{name: "all words", numWords: 300, budget: 1000, top: 0, minSpills: 2},
+		{name: "multi-pass merge", numWords: 2 * maxMergeFiles * 3, budget: 1, top: 10, minSpills: maxMergeFiles + 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wordfreq-test-")
+			if err != nil {
+				t.Fatalf("expect no error creating temp dir, got %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			doc := testDocument(c.numWords)
+			opts := AnalysisOptions{Top: c.top, MinWordLength: 1, Language: LanguageEnglish}
+
+			expect, err := WordCounter{}.Count(strings.NewReader(doc), opts)
+			if err != nil {
+				t.Fatalf("expect no error counting in memory, got %v", err)
+			}
+			if expect.Spilled() {
+				t.Fatalf("expect counts without a budget not to spill")
+			}
+
+			// The most spill files at once, checked periodically as words
+			// are counted, and merged.
+			spills, calls := 0, 0
+			counter := WordCounter{MemoryBudget: c.budget, TempDir: dir, Progress: func() error {
+				if calls++; calls%16 != 0 {
+					return nil
+				}
+				if n := len(tempFiles(t, dir)); n > spills {
+					spills = n
+				}
+				return nil
+			}}
+			actual, err := counter.Count(strings.NewReader(doc), opts)
+			if err != nil {
+				t.Fatalf("expect no error counting with budget, got %v", err)
+			}
+			if !actual.Spilled() {
+				t.Fatalf("expect counts with budget to spill")
+			}
+			if spills < c.minSpills {
+				t.Errorf("expect at least %d spill files, got %d", c.minSpills, spills)
+			}
+
+			if e, a := expect.Total, actual.Total; e != a {
+				t.Errorf("expect %d total words, got %d", e, a)
+			}
+			if e, a := expect.Vocabulary, actual.Vocabulary; e != a {
+				t.Errorf("expect %d vocabulary, got %d", e, a)
+			}
+			if e, a := expect.Top, actual.Top; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect top words\n%v\ngot\n%v", e, a)
+			}
+			if e, a := eachWords(t, expect), eachWords(t, actual); !reflect.DeepEqual(e, a) {
+				t.Errorf("expect spilled words in the same order as in memory words")
+			}
+
+			if files := tempFiles(t, dir); len(files) != 1 {
+				t.Errorf("expect only the merged spill file, got %v", files)
+			}
+			if err := actual.Close(); err != nil {
+				t.Errorf("expect no error closing counts, got %v", err)
+			}
+			if files := tempFiles(t, dir); len(files) != 0 {
+				t.Errorf("expect no files after close, got %v", files)
+			}
+		})
+	}
+}
+
+func TestMergeSpilledMatchesInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wordfreq-test-")
+	if err != nil {
+		t.Fatalf("expect no error creating temp dir, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := AnalysisOptions{MinWordLength: 1, Language: LanguageEnglish}
+	docs := []string{testDocument(200), testDocument(400), "other words"}
+
+	counts := []*WordCounts{}
+	for i, doc := range docs {
+		// Alternate counts in memory, and spilled.
+		counter := WordCounter{}
+		if i%2 == 0 {
+			counter = WordCounter{MemoryBudget: 1000, TempDir: dir}
+		}
+		c, err := counter.Count(strings.NewReader(doc), opts)
+		if err != nil {
+			t.Fatalf("expect no error counting, got %v", err)
+		}
+		defer c.Close()
+		counts = append(counts, c)
+	}
+
+	expect, err := WordCounter{}.Merge(5, counts...)
+	if err != nil {
+		t.Fatalf("expect no error merging in memory, got %v", err)
+	}
+	actual, err := WordCounter{MemoryBudget: 1000, TempDir: dir}.Merge(5, counts...)
+	if err != nil {
+		t.Fatalf("expect no error merging with budget, got %v", err)
+	}
+	defer actual.Close()
+
+	if !actual.Spilled() {
+		t.Fatalf("expect merge with budget to spill")
+	}
+	if e, a := expect.Top, actual.Top; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect top words\n%v\ngot\n%v", e, a)
+	}
+	if e, a := eachWords(t, expect), eachWords(t, actual); !reflect.DeepEqual(e, a) {
+		t.Errorf("expect spilled words in the same order as in memory words")
+	}
+}
+
+func TestCountRemovesSpillFilesOnError(t *testing.T) {
+	doc := testDocument(2 * maxMergeFiles * 3)
+	opts := AnalysisOptions{MinWordLength: 1, Language: LanguageEnglish}
+
+	// Count the number of progress calls of a successful count, so the
+	// count can be failed while counting, spilling, and merging.
+	calls := 0
+	counts, err := WordCounter{MemoryBudget: 1, Progress: func() error {
+		calls++
+		return nil
+	}}.Count(strings.NewReader(doc), opts)
+	if err != nil {
+		t.Fatalf("expect no error counting, got %v", err)
+	}
+	counts.Close()
+
+	failErr := errors.New("progress failed")
+	for _, failAt := range []int{1, calls / 4, calls / 2, calls - 1, calls} {
+		t.Run(fmt.Sprintf("fail at %d of %d", failAt, calls), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wordfreq-test-")
+			if err != nil {
+				t.Fatalf("expect no error creating temp dir, got %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			n := 0
+			counter := WordCounter{MemoryBudget: 1, TempDir: dir, Progress: func() error {
+				if n++; n == failAt {
+					return failErr
+				}
+				return nil
+			}}
+			counts, err := counter.Count(strings.NewReader(doc), opts)
+			if err == nil {
+				counts.Close()
+				t.Fatalf("expect error counting")
+			}
+			if e, a := ErrTransient, GetJobErrorCode(err); e != a {
+				t.Errorf("expect %s error code, got %s", e, a)
+			}
+			if files := tempFiles(t, dir); len(files) != 0 {
+				t.Errorf("expect no spill files after error, got %v", files)
+			}
+		})
+	}
+}
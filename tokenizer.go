@@ -0,0 +1,88 @@
+package wordfreq
+
+import (
+	"bufio"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A wordTokenizer splits content into words separated by whitespace, the same
+// as bufio.ScanWords, but without a maximum word length. Words longer than the
+// maximum length are skipped or truncated by the long word policy, so no more
+// than the maximum length of a word is ever held in memory.
+type wordTokenizer struct {
+	r      *bufio.Reader
+	maxLen int
+	policy string
+	word   []byte
+
+	// Number of long words skipped, and truncated.
+	skipped, truncated int
+}
+
+// newWordTokenizer creates a wordTokenizer reading words from the reader.
+func newWordTokenizer(r *bufio.Reader, maxLen int, policy string) *wordTokenizer {
+	return &wordTokenizer{r: r, maxLen: maxLen, policy: policy}
+}
+
+// next returns the next word, or false once all words have been read.
+func (t *wordTokenizer) next() (string, bool, error) {
+	for {
+		word, long, ok, err := t.read()
+		if err != nil || !ok {
+			return "", false, err
+		}
+		if !long {
+			return word, true, nil
+		}
+		if t.policy == LongWordTruncate {
+			t.truncated++
+			return word, true, nil
+		}
+		t.skipped++
+	}
+}
+
+// read reads the next whitespace separated run of characters, up to the
+// maximum length. The rest of a longer run is discarded, and long is true.
+func (t *wordTokenizer) read() (word string, long, ok bool, err error) {
+	t.word = t.word[:0]
+	for {
+		r, size, err := t.r.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", false, false, err
+		}
+
+		if unicode.IsSpace(r) {
+			if len(t.word) > 0 || long {
+				break
+			}
+			continue
+		}
+		if long {
+			continue
+		}
+		if len(t.word)+size > t.maxLen {
+			// Truncated words always end on a character boundary.
+			long = true
+			continue
+		}
+
+		if r == utf8.RuneError && size == 1 {
+			// Invalid bytes are kept as they are, the same as bufio.ScanWords.
+			t.r.UnreadRune()
+			b, _ := t.r.ReadByte()
+			t.word = append(t.word, b)
+		} else {
+			t.word = append(t.word, string(r)...)
+		}
+	}
+
+	if len(t.word) == 0 && !long {
+		return "", false, false, nil
+	}
+	return string(t.word), long, true, nil
+}
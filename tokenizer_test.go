@@ -0,0 +1,150 @@
+package wordfreq
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tokenize returns all words read by a wordTokenizer from the content, and the
+// tokenizer.
+func tokenize(t *testing.T, content string, maxLen int, policy string) ([]string, *wordTokenizer) {
+	tokenizer := newWordTokenizer(bufio.NewReaderSize(strings.NewReader(content), 16), maxLen, policy)
+	words := []string{}
+	for {
+		word, ok, err := tokenizer.next()
+		if err != nil {
+			t.Fatalf("expect no error, got %v", err)
+		}
+		if !ok {
+			return words, tokenizer
+		}
+		words = append(words, word)
+	}
+}
+
+func TestWordTokenizer(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+
+	cases := []struct {
+		name            string
+		content         string
+		maxLen          int
+		policy          string
+		expectWords     []string
+		expectSkipped   int
+		expectTruncated int
+	}{
+		{name: "whitespace", content: "  one\ttwo\n\nthree four\r\n", maxLen: 10, policy: LongWordSkip,
+			expectWords: []string{"one", "two", "three", "four"}},
+		{name: "empty", content: " \n\t ", maxLen: 10, policy: LongWordSkip,
+			expectWords: []string{}},
+		{name: "exact max length", content: "abcd abcde", maxLen: 5, policy: LongWordSkip,
+			expectWords: []string{"abcd", "abcde"}},
+		{name: "skip", content: "short abcdefgh more ijklmnop", maxLen: 5, policy: LongWordSkip,
+			expectWords: []string{"short", "more"}, expectSkipped: 2},
+		{name: "truncate", content: "short abcdefgh more ijklmnop", maxLen: 5, policy: LongWordTruncate,
+			expectWords: []string{"short", "abcde", "more", "ijklm"}, expectTruncated: 2},
+		{name: "skip very long", content: "first " + long + " last", maxLen: 1024, policy: LongWordSkip,
+			expectWords: []string{"first", "last"}, expectSkipped: 1},
+		{name: "truncate very long", content: "first " + long + " last", maxLen: 1024, policy: LongWordTruncate,
+			expectWords: []string{"first", long[:1024], "last"}, expectTruncated: 1},
+		{name: "very long at end", content: "first " + long, maxLen: 1024, policy: LongWordTruncate,
+			expectWords: []string{"first", long[:1024]}, expectTruncated: 1},
+		{name: "truncate on character boundary", content: "ééé 😀😀", maxLen: 5, policy: LongWordTruncate,
+			expectWords: []string{"éé", "😀"}, expectTruncated: 2},
+		{name: "invalid bytes kept", content: "ab\xffcd ef", maxLen: 10, policy: LongWordSkip,
+			expectWords: []string{"ab\xffcd", "ef"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			words, tokenizer := tokenize(t, c.content, c.maxLen, c.policy)
+			if e, a := c.expectWords, words; !reflect.DeepEqual(e, a) {
+				if len(e) < 10 && len(a) < 10 && len(c.content) < 100 {
+					t.Errorf("expect words %q, got %q", e, a)
+				} else {
+					t.Errorf("expect %d words, got %d", len(e), len(a))
+				}
+			}
+			if e, a := c.expectSkipped, tokenizer.skipped; e != a {
+				t.Errorf("expect %d skipped, got %d", e, a)
+			}
+			if e, a := c.expectTruncated, tokenizer.truncated; e != a {
+				t.Errorf("expect %d truncated, got %d", e, a)
+			}
+		})
+	}
+}
+
+func TestCountLongWords(t *testing.T) {
+	doc := "alpha " + strings.Repeat("b", 5000) + " alpha gamma " +
+		strings.Repeat("c", 3000) + " " + strings.Repeat("b", 2000)
+
+	cases := []struct {
+		policy          string
+		expectWords     map[string]int
+		expectSkipped   int
+		expectTruncated int
+	}{
+		{policy: LongWordSkip,
+			expectWords:   map[string]int{"alpha": 2, "gamma": 1},
+			expectSkipped: 3},
+		{policy: LongWordTruncate,
+			expectWords: map[string]int{
+				"alpha": 2, "gamma": 1,
+				strings.Repeat("b", 1024): 2, strings.Repeat("c", 1024): 1,
+			},
+			expectTruncated: 3},
+	}
+
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			opts := AnalysisOptions{
+				MinWordLength: 1, Language: LanguageEnglish,
+				MaxWordLength: 1024, LongWordPolicy: c.policy,
+			}
+			counts, err := WordCounter{}.Count(strings.NewReader(doc), opts)
+			if err != nil {
+				t.Fatalf("expect no error, got %v", err)
+			}
+			if e, a := c.expectWords, counts.Words; !reflect.DeepEqual(e, a) {
+				t.Errorf("expect %d words, got %d", len(e), len(a))
+			}
+			if e, a := c.expectSkipped, counts.SkippedWords; e != a {
+				t.Errorf("expect %d skipped, got %d", e, a)
+			}
+			if e, a := c.expectTruncated, counts.TruncatedWords; e != a {
+				t.Errorf("expect %d truncated, got %d", e, a)
+			}
+		})
+	}
+}
+
+func TestValidateWordLengths(t *testing.T) {
+	cases := []struct {
+		name      string
+		opts      AnalysisOptions
+		expectErr bool
+	}{
+		{name: "defaults", opts: AnalysisOptions{}},
+		{name: "only max", opts: AnalysisOptions{MaxWordLength: 4}},
+		{name: "only min", opts: AnalysisOptions{MinWordLength: 2000}},
+		{name: "max equals min", opts: AnalysisOptions{MinWordLength: 8, MaxWordLength: 8}},
+		{name: "max less than min", opts: AnalysisOptions{MinWordLength: 8, MaxWordLength: 7}, expectErr: true},
+		{name: "max less than character", opts: AnalysisOptions{MinWordLength: 1, MaxWordLength: 3}, expectErr: true},
+		{name: "negative max", opts: AnalysisOptions{MaxWordLength: -1}, expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.opts.Validate()
+			if c.expectErr && err == nil {
+				t.Errorf("expect error")
+			} else if !c.expectErr && err != nil {
+				t.Errorf("expect no error, got %v", err)
+			}
+		})
+	}
+}